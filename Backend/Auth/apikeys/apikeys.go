@@ -0,0 +1,355 @@
+// Package apikeys manages the personal API keys of accounts. MongoDB holds
+// the record of every key; Redis holds the lookups the services resolve keys
+// through, and is restored from MongoDB when it loses them.
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"authService.com/auth/utils"
+
+	"rysto/pkg/apikey"
+	"rysto/pkg/redis"
+)
+
+// MaxPerUser bounds how many live keys one account may hold.
+const MaxPerUser = 20
+
+var (
+	ErrNotFound = errors.New("api key not found")
+	ErrTooMany  = errors.New("too many api keys")
+)
+
+// Key describes an API key without its secret.
+type Key struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// record is a key as stored in MongoDB. Only the digest of the key is kept.
+type record struct {
+	ID        string     `bson:"_id"`
+	Hash      string     `bson:"hash"`
+	UserID    string     `bson:"userId"`
+	Handle    string     `bson:"handle"`
+	Name      string     `bson:"name"`
+	Prefix    string     `bson:"prefix"`
+	Scopes    []string   `bson:"scopes"`
+	CreatedAt time.Time  `bson:"createdAt"`
+	ExpiresAt *time.Time `bson:"expiresAt,omitempty"`
+}
+
+func (r *record) key() Key {
+	return Key{
+		ID:        r.ID,
+		Name:      r.Name,
+		Prefix:    r.Prefix,
+		Scopes:    r.Scopes,
+		CreatedAt: r.CreatedAt,
+		ExpiresAt: r.ExpiresAt,
+	}
+}
+
+// Redis layout:
+//
+//	apikey:<hash>          hash {id, user, handle, scopes} (read by every service)
+//	apikeys:last_used      hash key ID -> unix seconds (written by every service)
+//
+// Lookups of keys with an expiry expire on their own; MongoDB drops their
+// records at the same time.
+
+var collection *mongo.Collection
+
+// SetCollection injects the collection key records are kept in.
+func SetCollection(c *mongo.Collection) {
+	collection = c
+}
+
+// EnsureIndexes indexes keys by owner and digest and lets MongoDB drop
+// expired ones.
+func EnsureIndexes(ctx context.Context) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// notExpired matches keys that have not expired. MongoDB removes expired
+// records only once a minute.
+func notExpired() bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"expiresAt": bson.M{"$exists": false}},
+		bson.M{"expiresAt": bson.M{"$gt": time.Now()}},
+	}}
+}
+
+// live matches the user's keys that have not expired.
+func live(userID string) bson.M {
+	filter := notExpired()
+	filter["userId"] = userID
+	return filter
+}
+
+// publish writes the lookup of r the services resolve the key through.
+func publish(ctx context.Context, pipe goredis.Pipeliner, r *record) {
+	pipe.HSet(ctx, apikey.LookupKey(r.Hash),
+		"id", r.ID,
+		"user", r.UserID,
+		"handle", r.Handle,
+		"scopes", strings.Join(r.Scopes, " "),
+	)
+	if r.ExpiresAt != nil {
+		pipe.ExpireAt(ctx, apikey.LookupKey(r.Hash), *r.ExpiresAt)
+	}
+}
+
+// Create issues a new key for the user and returns it together with its
+// description. The key itself is only ever returned here. ttl 0 means the
+// key does not expire.
+func Create(ctx context.Context, userID, handle, name string, scopes []string, ttl time.Duration) (string, *Key, error) {
+	n, err := collection.CountDocuments(ctx, live(userID))
+	if err != nil {
+		return "", nil, err
+	}
+	if n >= MaxPerUser {
+		return "", nil, ErrTooMany
+	}
+
+	id, err := utils.GenerateOpaqueToken(12)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	raw := apikey.Prefix + secret
+
+	r := &record{
+		ID:        id,
+		Hash:      apikey.Hash(raw),
+		UserID:    userID,
+		Handle:    handle,
+		Name:      name,
+		Prefix:    raw[:len(apikey.Prefix)+6],
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		exp := r.CreatedAt.Add(ttl)
+		r.ExpiresAt = &exp
+	}
+
+	if _, err := collection.InsertOne(ctx, r); err != nil {
+		return "", nil, err
+	}
+	pipe := redis.Client.TxPipeline()
+	publish(ctx, pipe, r)
+	if _, err := pipe.Exec(ctx); err != nil {
+		// Nobody will ever see the key, so do not keep it.
+		collection.DeleteOne(ctx, bson.M{"_id": r.ID})
+		return "", nil, err
+	}
+	key := r.key()
+	return raw, &key, nil
+}
+
+// List returns the user's live keys, newest first.
+func List(ctx context.Context, userID string) ([]Key, error) {
+	cursor, err := collection.Find(ctx, live(userID),
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	keys := make([]Key, 0, len(records))
+	for i := range records {
+		key := records[i].key()
+		used, err := redis.Client.HGet(ctx, apikey.LastUsedKey, key.ID).Result()
+		if err != nil && err != goredis.Nil {
+			return nil, err
+		}
+		if t := unixField(used); !t.IsZero() {
+			key.LastUsedAt = &t
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Revoke deletes one of the user's keys. It stops working in every service
+// immediately.
+func Revoke(ctx context.Context, userID, id string) error {
+	var r record
+	err := collection.FindOne(ctx, bson.M{"_id": id, "userId": userID}).Decode(&r)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return revoke(ctx, []record{r})
+}
+
+// RevokeAll deletes every key of the user and returns how many were live.
+func RevokeAll(ctx context.Context, userID string) (int, error) {
+	cursor, err := collection.Find(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return 0, err
+	}
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	revoked := 0
+	for i := range records {
+		if records[i].ExpiresAt == nil || records[i].ExpiresAt.After(now) {
+			revoked++
+		}
+	}
+	return revoked, revoke(ctx, records)
+}
+
+// revoke removes the lookups of records before the records themselves, so a
+// key can never outlive a failed revocation.
+func revoke(ctx context.Context, records []record) error {
+	ids := make([]string, len(records))
+	pipe := redis.Client.TxPipeline()
+	for i := range records {
+		ids[i] = records[i].ID
+		pipe.Del(ctx, apikey.LookupKey(records[i].Hash))
+	}
+	pipe.HDel(ctx, apikey.LastUsedKey, ids...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	_, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+// SetHandle updates the handle the user's keys write content under, after
+// the user changed it.
+func SetHandle(ctx context.Context, userID, handle string) error {
+	if _, err := collection.UpdateMany(ctx, bson.M{"userId": userID}, bson.M{"$set": bson.M{"handle": handle}}); err != nil {
+		return err
+	}
+
+	cursor, err := collection.Find(ctx, live(userID))
+	if err != nil {
+		return err
+	}
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return err
+	}
+	pipe := redis.Client.TxPipeline()
+	for i := range records {
+		publish(ctx, pipe, &records[i])
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// PublishAll writes the lookup of every live key to Redis, so keys keep
+// working after Redis lost its data. It returns how many were written.
+func PublishAll(ctx context.Context) (int, error) {
+	cursor, err := collection.Find(ctx, notExpired())
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	published := 0
+	for cursor.Next(ctx) {
+		var r record
+		if err := cursor.Decode(&r); err != nil {
+			return published, err
+		}
+		pipe := redis.Client.TxPipeline()
+		publish(ctx, pipe, &r)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, cursor.Err()
+}
+
+// ImportFromRedis moves keys created while Redis was their only store into
+// MongoDB and drops their old Redis bookkeeping. Their lookups stay as they
+// are. It returns how many keys were moved.
+func ImportFromRedis(ctx context.Context) (int, error) {
+	imported := 0
+	iter := redis.Client.Scan(ctx, 0, "apikey_meta:*", 100).Iterator()
+	for iter.Next(ctx) {
+		meta := iter.Val()
+		fields, err := redis.Client.HGetAll(ctx, meta).Result()
+		if err != nil {
+			return imported, err
+		}
+		handle, err := redis.Client.HGet(ctx, apikey.LookupKey(fields["hash"]), "handle").Result()
+		if err == goredis.Nil || fields["hash"] == "" || fields["user"] == "" {
+			// Expired or revoked halfway: there is no key left to keep.
+			redis.Client.Del(ctx, meta)
+			continue
+		}
+		if err != nil {
+			return imported, err
+		}
+
+		r := record{
+			ID:        strings.TrimPrefix(meta, "apikey_meta:"),
+			Hash:      fields["hash"],
+			UserID:    fields["user"],
+			Handle:    handle,
+			Name:      fields["name"],
+			Prefix:    fields["prefix"],
+			Scopes:    strings.Fields(fields["scopes"]),
+			CreatedAt: unixField(fields["createdAt"]),
+		}
+		if exp := unixField(fields["expiresAt"]); !exp.IsZero() {
+			r.ExpiresAt = &exp
+		}
+		if _, err := collection.InsertOne(ctx, r); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return imported, err
+		}
+		if err := redis.Client.Del(ctx, meta, "user_apikeys:"+r.UserID).Err(); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	return imported, iter.Err()
+}
+
+func unixField(v string) time.Time {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(n, 0)
+}
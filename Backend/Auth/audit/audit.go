@@ -0,0 +1,156 @@
+// Package audit keeps the security history of accounts: sign-ins, sign-outs,
+// password and role changes and session revocations. Events are only ever
+// inserted; nothing in Auth updates or deletes them, and they expire after
+// the retention period.
+package audit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Event types.
+const (
+	TypeRegistered      = "account.registered"
+	TypeDeleted         = "account.deleted"
+	TypeLocked          = "account.locked"
+	TypeSuspended       = "account.suspended"
+	TypeBanned          = "account.banned"
+	TypeReinstated      = "account.reinstated"
+	TypeLoginSucceeded  = "login.succeeded"
+	TypeLoginFailed     = "login.failed"
+	TypeLogout          = "logout"
+	TypeLogoutAll       = "logout.all"
+	TypePasswordChanged = "password.changed"
+	TypeRoleGranted     = "role.granted"
+	TypeRoleRevoked     = "role.revoked"
+	TypeSessionRevoked  = "session.revoked"
+)
+
+// DefaultRetention is how long events are kept unless configured otherwise.
+const DefaultRetention = 365 * 24 * time.Hour
+
+// Event is one entry of the audit log. UserID is the account the event is
+// about; ActorID is set when someone else, such as an admin, caused it.
+// Failed logins for unknown addresses carry only the Email that was tried.
+type Event struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Type      string             `bson:"type" json:"type"`
+	UserID    string             `bson:"userId,omitempty" json:"userId,omitempty"`
+	ActorID   string             `bson:"actorId,omitempty" json:"actorId,omitempty"`
+	Email     string             `bson:"email,omitempty" json:"email,omitempty"`
+	SessionID string             `bson:"sessionId,omitempty" json:"sessionId,omitempty"`
+	IP        string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent string             `bson:"userAgent,omitempty" json:"userAgent,omitempty"`
+	Details   map[string]string  `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// Filter narrows a query. Zero fields match everything; Before pages
+// backwards from an event ID.
+type Filter struct {
+	UserID string
+	Type   string
+	IP     string
+	Since  time.Time
+	Until  time.Time
+	Before primitive.ObjectID
+	Limit  int64
+}
+
+var collection *mongo.Collection
+
+// SetCollection injects the collection events are written to.
+func SetCollection(c *mongo.Collection) {
+	collection = c
+}
+
+// EnsureIndexes indexes events for the per-user and admin queries and lets
+// MongoDB drop events older than retention.
+func EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "ip", Value: 1}, {Key: "_id", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	expire := int32(retention.Seconds())
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "createdAt", Value: 1}},
+		Options: options.Index().SetName(ttlIndex).SetExpireAfterSeconds(expire),
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Name == "IndexOptionsConflict" {
+		// The retention changed since the index was built.
+		return collection.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: collection.Name()},
+			{Key: "index", Value: bson.M{"name": ttlIndex, "expireAfterSeconds": expire}},
+		}).Err()
+	}
+	return err
+}
+
+const ttlIndex = "createdAt_ttl"
+
+// Record appends e to the log. A failure is logged rather than returned: a
+// request never fails because its audit entry could not be written.
+func Record(e Event) {
+	e.ID = primitive.NilObjectID
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := collection.InsertOne(ctx, e); err != nil {
+		log.Printf("audit: failed to record %s for %q: %v", e.Type, e.UserID, err)
+	}
+}
+
+// Query returns the newest events matching f, newest first.
+func Query(ctx context.Context, f Filter) ([]Event, error) {
+	q := bson.M{}
+	if f.UserID != "" {
+		q["userId"] = f.UserID
+	}
+	if f.Type != "" {
+		q["type"] = f.Type
+	}
+	if f.IP != "" {
+		q["ip"] = f.IP
+	}
+	if !f.Before.IsZero() {
+		q["_id"] = bson.M{"$lt": f.Before}
+	}
+	created := bson.M{}
+	if !f.Since.IsZero() {
+		created["$gte"] = f.Since
+	}
+	if !f.Until.IsZero() {
+		created["$lt"] = f.Until
+	}
+	if len(created) > 0 {
+		q["createdAt"] = created
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(f.Limit)
+	cursor, err := collection.Find(ctx, q, opts)
+	if err != nil {
+		return nil, err
+	}
+	events := []Event{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,167 @@
+// Package cascade fans out per-user requests to the internal endpoints of the
+// services holding user content: purging it when an account is deleted,
+// collecting it for a data export and renaming it when the handle changes.
+package cascade
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"authService.com/auth/utils"
+
+	"rysto/pkg/purge"
+	"rysto/pkg/redis"
+)
+
+// Result statuses.
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// Service is a service holding user content.
+type Service struct {
+	Name    string
+	BaseURL string
+}
+
+// Result is what happened at one service.
+type Result struct {
+	Service string           `json:"service"`
+	Status  string           `json:"status"`
+	Counts  map[string]int64 `json:"counts,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+var (
+	services []Service
+	client   = &http.Client{Timeout: 15 * time.Second}
+)
+
+// pendingKey is the Redis set of continuations Stories removed during a purge
+// of userID that has not completed yet; kept for pendingTTL.
+func pendingKey(userID string) string { return "purge_removed:" + userID }
+
+const pendingTTL = 7 * 24 * time.Hour
+
+// SetServices configures the services to purge.
+func SetServices(s []Service) {
+	services = s
+}
+
+// ServicesFromEnv reads STORY_SERVICE_URL and VOTING_SERVICE_URL. A service
+// without a URL fails every purge, so accounts cannot be deleted while their
+// content would stay behind.
+func ServicesFromEnv() []Service {
+	return []Service{
+		{Name: "stories", BaseURL: strings.TrimRight(os.Getenv("STORY_SERVICE_URL"), "/")},
+		{Name: "voting", BaseURL: strings.TrimRight(os.Getenv("VOTING_SERVICE_URL"), "/")},
+	}
+}
+
+// Purge asks every service to apply mode to the content of userID. Stories
+// goes first and Voting drops the votes on the continuations it removed. ok
+// is false if any service failed or is not configured; purges are
+// idempotent, so the caller can simply retry.
+func Purge(ctx context.Context, userID, mode string) (results []Result, ok bool) {
+	req := purge.Request{Mode: mode}
+	// Continuations removed by an earlier attempt that failed further on:
+	// Stories will not report them again.
+	pending, err := redis.Client.SMembers(ctx, pendingKey(userID)).Result()
+	if err != nil {
+		log.Printf("Purge: failed to load pending continuations of %s: %v", userID, err)
+	}
+	req.RemovedContinuations = pending
+
+	ok = true
+	for _, svc := range services {
+		res := Result{Service: svc.Name}
+		if svc.BaseURL == "" {
+			res.Status = StatusFailed
+			res.Error = "service URL not configured"
+			ok = false
+		} else if report, err := call(ctx, svc, userID, req); err != nil {
+			res.Status = StatusFailed
+			res.Error = err.Error()
+			ok = false
+		} else {
+			res.Status = StatusOK
+			res.Counts = report.Counts
+			req.RemovedContinuations = append(req.RemovedContinuations, report.RemovedContinuations...)
+		}
+		results = append(results, res)
+	}
+
+	if ok {
+		redis.Client.Del(ctx, pendingKey(userID))
+	} else if len(req.RemovedContinuations) > len(pending) {
+		pipe := redis.Client.TxPipeline()
+		pipe.SAdd(ctx, pendingKey(userID), req.RemovedContinuations[len(pending):])
+		pipe.Expire(ctx, pendingKey(userID), pendingTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("Purge: failed to keep pending continuations of %s: %v", userID, err)
+		}
+	}
+	return results, ok
+}
+
+func call(ctx context.Context, svc Service, userID string, req purge.Request) (*purge.Report, error) {
+	var report purge.Report
+	if err := do(ctx, svc, http.MethodPost, userID, "/purge", req, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// do sends body (if any) as JSON to the internal endpoint
+// <service>/internal/users/<userID><suffix> with a fresh service token and
+// decodes the response into out.
+func do(ctx context.Context, svc Service, method, userID, suffix string, body, out any) error {
+	serviceToken, err := utils.GenerateServiceToken()
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	endpoint := svc.BaseURL + "/internal/users/" + url.PathEscape(userID) + suffix
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+serviceToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", svc.Name, resp.Status, bytes.TrimSpace(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", svc.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"rysto/pkg/takeout"
+)
+
+// Export is everything the other services hold about a user. Skipped lists
+// services whose URL is not configured.
+type Export struct {
+	Stories takeout.StoriesExport
+	Votes   takeout.VotesExport
+	Skipped []string
+}
+
+// Collect fetches the user's content from every configured service. Unlike
+// Purge it stops at the first failure, since a partial export would look
+// complete to the user.
+func Collect(ctx context.Context, userID string) (*Export, error) {
+	export := &Export{
+		Stories: takeout.StoriesExport{Stories: []takeout.Story{}, Continuations: []takeout.Continuation{}},
+		Votes:   takeout.VotesExport{Votes: []takeout.Vote{}},
+	}
+
+	for _, svc := range services {
+		if svc.BaseURL == "" {
+			export.Skipped = append(export.Skipped, svc.Name)
+			continue
+		}
+
+		var out any
+		switch svc.Name {
+		case "stories":
+			out = &export.Stories
+		case "voting":
+			out = &export.Votes
+		default:
+			return nil, fmt.Errorf("no export format for service %q", svc.Name)
+		}
+		if err := do(ctx, svc, http.MethodGet, userID, "/export", nil, out); err != nil {
+			return nil, err
+		}
+	}
+	return export, nil
+}
@@ -0,0 +1,24 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Rename tells Stories that userID now goes by handle, so the handle shown
+// on and searched by for the user's stories stays current. Stories is the
+// only service that keeps handles.
+func Rename(ctx context.Context, userID, handle string) error {
+	for _, svc := range services {
+		if svc.Name != "stories" {
+			continue
+		}
+		if svc.BaseURL == "" {
+			return errors.New("stories: service URL not configured")
+		}
+		var counts map[string]int64
+		return do(ctx, svc, http.MethodPut, userID, "/handle", map[string]string{"handle": handle}, &counts)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Command genkey writes a new PKCS#8 private key for signing access tokens.
+//
+//	go run ./cmd/genkey -alg ed25519 -out keys/signing.pem
+//
+// To rotate, generate a new key and put it first in JWT_SIGNING_KEYS while
+// keeping the old one listed until the tokens it signed have expired.
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"log"
+	"os"
+
+	"rysto/pkg/token"
+)
+
+func main() {
+	alg := flag.String("alg", "ed25519", "key algorithm: ed25519 or rsa")
+	out := flag.String("out", "signing.pem", "output file")
+	flag.Parse()
+
+	var key crypto.Signer
+	var err error
+	switch *alg {
+	case "ed25519":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case "rsa":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		log.Fatalf("unknown algorithm %q", *alg)
+	}
+	if err != nil {
+		log.Fatalf("Failed to generate key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		log.Fatalf("Failed to encode key: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(*out, data, 0600); err != nil {
+		log.Fatalf("Failed to write key: %v", err)
+	}
+
+	jwk, _ := token.NewJWK("", key.Public())
+	log.Printf("Wrote %s key %s to %s", *alg, jwk.Kid, *out)
+}
@@ -0,0 +1,217 @@
+// Command migrate-ids rewrites content that is still keyed by email address
+// to the author's user ID. Run it once, with the services stopped, when
+// deploying user ID based identity:
+//
+//	MONGODB_URI=... REDIS_ADDR=... go run ./cmd/migrate-ids
+//
+// It updates authorId/authorHandle on stories and continuations and replaces
+// voterEmail with voterId on votes. Content whose email no longer belongs to
+// an account is detached from any user. Unless -keep-sessions is given it
+// also deletes session data created before the switch, which was keyed by
+// email, so everyone has to log in again.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"authService.com/auth/models"
+
+	"rysto/pkg/redis"
+)
+
+type identity struct {
+	id     string
+	handle string
+}
+
+func main() {
+	dbName := flag.String("db", "RystoDB", "MongoDB database")
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing")
+	keepSessions := flag.Bool("keep-sessions", false, "leave pre-migration sessions in Redis")
+	flag.Parse()
+
+	_ = godotenv.Load()
+
+	mongoURI := os.Getenv("MONGODB_URI")
+	if mongoURI == "" {
+		log.Fatal("Error: MONGODB_URI not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	if err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+	db := client.Database(*dbName)
+
+	users, err := loadUsers(ctx, db.Collection("users"))
+	if err != nil {
+		log.Fatalf("Failed to load users: %v", err)
+	}
+	log.Printf("Loaded %d users", len(users))
+
+	for _, name := range []string{"stories", "continuations"} {
+		n, orphans, err := migrateAuthors(ctx, db.Collection(name), users, *dryRun)
+		if err != nil {
+			log.Fatalf("Failed to migrate %s: %v", name, err)
+		}
+		log.Printf("%s: %d documents rewritten, %d detached from deleted accounts", name, n, orphans)
+	}
+
+	n, orphans, err := migrateVotes(ctx, db.Collection("votes"), users, *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to migrate votes: %v", err)
+	}
+	log.Printf("votes: %d documents rewritten, %d detached from deleted accounts", n, orphans)
+
+	if *keepSessions || *dryRun {
+		return
+	}
+
+	redis.InitRedis()
+	deleted, err := clearSessions(ctx)
+	if err != nil {
+		log.Fatalf("Failed to clear sessions: %v", err)
+	}
+	log.Printf("Deleted %d pre-migration session keys; users have to log in again", deleted)
+}
+
+// loadUsers maps every account's email to its ID and handle.
+func loadUsers(ctx context.Context, coll *mongo.Collection) (map[string]identity, error) {
+	cursor, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := make(map[string]identity)
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		users[user.Email] = identity{id: user.ID.Hex(), handle: user.Handle}
+	}
+	return users, cursor.Err()
+}
+
+// emailsIn returns the distinct values of field that look like email
+// addresses.
+func emailsIn(ctx context.Context, coll *mongo.Collection, field string) ([]string, error) {
+	values, err := coll.Distinct(ctx, field, bson.M{field: bson.M{"$regex": "@"}})
+	if err != nil {
+		return nil, err
+	}
+	emails := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok && strings.Contains(s, "@") {
+			emails = append(emails, s)
+		}
+	}
+	return emails, nil
+}
+
+func migrateAuthors(ctx context.Context, coll *mongo.Collection, users map[string]identity, dryRun bool) (rewritten, orphans int64, err error) {
+	emails, err := emailsIn(ctx, coll, "authorId")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, email := range emails {
+		filter := bson.M{"authorId": email}
+		update := bson.M{"$set": bson.M{"authorId": ""}, "$unset": bson.M{"authorHandle": ""}}
+		user, known := users[email]
+		if known {
+			update = bson.M{"$set": bson.M{"authorId": user.id, "authorHandle": user.handle}}
+		}
+
+		n, err := apply(ctx, coll, filter, update, dryRun)
+		if err != nil {
+			return rewritten, orphans, err
+		}
+		if known {
+			rewritten += n
+		} else {
+			orphans += n
+		}
+	}
+	return rewritten, orphans, nil
+}
+
+func migrateVotes(ctx context.Context, coll *mongo.Collection, users map[string]identity, dryRun bool) (rewritten, orphans int64, err error) {
+	emails, err := emailsIn(ctx, coll, "voterEmail")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, email := range emails {
+		id := ""
+		user, known := users[email]
+		if known {
+			id = user.id
+		}
+
+		n, err := apply(ctx, coll,
+			bson.M{"voterEmail": email},
+			bson.M{"$set": bson.M{"voterId": id}, "$unset": bson.M{"voterEmail": ""}},
+			dryRun,
+		)
+		if err != nil {
+			return rewritten, orphans, err
+		}
+		if known {
+			rewritten += n
+		} else {
+			orphans += n
+		}
+	}
+	return rewritten, orphans, nil
+}
+
+// apply runs update on every document matching filter, or only counts them
+// in a dry run.
+func apply(ctx context.Context, coll *mongo.Collection, filter, update bson.M, dryRun bool) (int64, error) {
+	if dryRun {
+		return coll.CountDocuments(ctx, filter)
+	}
+	res, err := coll.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// clearSessions deletes sessions, refresh tokens and login challenges that
+// still reference users by email. Access tokens expire on their own and no
+// longer pass the user ID check.
+func clearSessions(ctx context.Context) (int64, error) {
+	var deleted int64
+	for _, pattern := range []string{"session:*", "user_sessions:*", "refresh:*", "mfa:*", "totp_used:*"} {
+		iter := redis.Client.Scan(ctx, 0, pattern, 1000).Iterator()
+		for iter.Next(ctx) {
+			n, err := redis.Client.Del(ctx, iter.Val()).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+		}
+		if err := iter.Err(); err != nil {
+			return deleted, err
+		}
+	}
+	n, err := redis.Client.Del(ctx, "sessions:active").Result()
+	return deleted + n, err
+}
@@ -0,0 +1,57 @@
+// Command mock-idp runs the in-process mock OpenID Connect provider on its
+// own, so "Sign in with" can be tried locally without a real provider.
+//
+//	go run ./cmd/mock-idp -addr :9000 -user alice@example.com
+//
+// Point Auth at it with:
+//
+//	OIDC_PROVIDERS=mock
+//	OIDC_MOCK_ISSUER=http://localhost:9000
+//	OIDC_MOCK_CLIENT_ID=rysto
+//	OIDC_MOCK_CLIENT_SECRET=secret
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"authService.com/auth/oidc/mockidp"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "public base URL of the provider")
+	clientID := flag.String("client-id", "rysto", "client ID Auth uses")
+	clientSecret := flag.String("client-secret", "secret", "client secret Auth uses")
+	users := flag.String("user", "alice@example.com", "comma-separated emails of users with verified addresses")
+	flag.Parse()
+
+	idp, err := mockidp.Start(mockidp.Config{
+		Addr:         *addr,
+		Issuer:       *issuer,
+		ClientID:     *clientID,
+		ClientSecret: *clientSecret,
+	})
+	if err != nil {
+		log.Fatalf("Failed to start mock provider: %v", err)
+	}
+	defer idp.Close()
+
+	for _, email := range strings.Split(*users, ",") {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+		local, _, _ := strings.Cut(email, "@")
+		idp.AddUser(mockidp.User{Subject: "mock-" + local, Email: email, EmailVerified: true, Name: local})
+		log.Printf("Mock user %s", email)
+	}
+	log.Printf("Mock OpenID provider %s listening on %s", idp.URL, *addr)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"authService.com/auth/apikeys"
+	"authService.com/auth/audit"
+	"authService.com/auth/cascade"
+	"authService.com/auth/mailer"
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+	"authService.com/auth/sessions"
+	"authService.com/auth/tokens"
+
+	"rysto/pkg/purge"
+)
+
+// deleteConfirmTTL is how long the emailed confirmation of an account
+// deletion stays valid.
+const deleteConfirmTTL = time.Hour
+
+// DeleteAccountInput re-authenticates the user before their account is
+// deleted. Accounts with two-factor authentication also need a code.
+// Accounts without a password, created through a sign-in provider, confirm
+// with the code alone or, without two-factor authentication, with the token
+// emailed to them.
+type DeleteAccountInput struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+	Token        string `json:"token"`
+	Mode         string `json:"mode"` // anonymize (default) or delete
+}
+
+// DeleteAccount deletes the logged-in user's account. Stories and Voting are
+// told first to anonymize or remove the user's content; if any of them
+// fails, the account is kept so the request can be retried. An account
+// without a password or two-factor authentication is first sent a
+// confirmation token, and deleted when the request is repeated with it.
+func DeleteAccount(c *gin.Context) {
+	start := time.Now()
+
+	var input DeleteAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/account/delete", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Mode == "" {
+		input.Mode = purge.ModeAnonymize
+	}
+	if !purge.ValidMode(input.Mode) {
+		metrics.HttpRequests.WithLabelValues("/account/delete", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be anonymize or delete"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, currentUser(c)).Decode(&user); err != nil {
+		metrics.HttpRequests.WithLabelValues("/account/delete", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	switch {
+	case user.Password != "":
+		if !checkPassword(&user, input.Password) {
+			metrics.HttpRequests.WithLabelValues("/account/delete", "401").Inc()
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password or code"})
+			return
+		}
+	case user.TOTPEnabled:
+		// The code checked below is all the account has to show.
+	case input.Token == "":
+		requestDeleteConfirmation(c, &user)
+		return
+	default:
+		value, err := tokens.ConsumeOneTime(tokens.PurposeDeleteAccount, input.Token)
+		if err != nil && err != tokens.ErrInvalidToken {
+			metrics.HttpRequests.WithLabelValues("/account/delete", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check confirmation token"})
+			return
+		}
+		if err == tokens.ErrInvalidToken || value != user.ID.Hex() {
+			metrics.HttpRequests.WithLabelValues("/account/delete", "401").Inc()
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired confirmation token"})
+			return
+		}
+	}
+	if user.TOTPEnabled {
+		var ok bool
+		var err error
+		switch {
+		case input.Code != "":
+			ok, err = checkTOTP(&user, user.TOTPSecret, input.Code)
+		case input.RecoveryCode != "":
+			ok, err = useRecoveryCode(ctx, &user, input.RecoveryCode)
+		}
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/account/delete", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+			return
+		}
+		if !ok {
+			metrics.HttpRequests.WithLabelValues("/account/delete", "401").Inc()
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password or code"})
+			return
+		}
+	}
+
+	userID := user.ID.Hex()
+	results, ok := cascade.Purge(ctx, userID, input.Mode)
+	if !ok {
+		metrics.HttpRequests.WithLabelValues("/account/delete", "502").Inc()
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":    "Could not clean up your content in every service; your account was not deleted. Please try again.",
+			"services": results,
+		})
+		return
+	}
+
+	if _, err := userCollection.DeleteOne(ctx, bson.M{"_id": user.ID}); err != nil {
+		metrics.HttpRequests.WithLabelValues("/account/delete", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account", "services": results})
+		return
+	}
+
+	revoked, err := sessions.RevokeAll(userID)
+	if err != nil {
+		log.Printf("DeleteAccount: failed to revoke sessions of %s: %v", userID, err)
+	}
+	if _, err := apikeys.RevokeAll(ctx, userID); err != nil {
+		log.Printf("DeleteAccount: failed to revoke API keys of %s: %v", userID, err)
+	}
+	if err := deleteOwnedClients(ctx, userID); err != nil {
+		log.Printf("DeleteAccount: failed to delete apps of %s: %v", userID, err)
+	}
+	if _, err := inviteCollection.DeleteMany(ctx, bson.M{"createdBy": userID}); err != nil {
+		log.Printf("DeleteAccount: failed to delete invites of %s: %v", userID, err)
+	}
+
+	sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Rysto account was deleted",
+		Body: "Your Rysto account @" + user.Handle + " and its sign-in data were deleted.\n\n" +
+			"If you did not do this, contact us right away.",
+	})
+
+	recordEvent(c, audit.Event{
+		Type:    audit.TypeDeleted,
+		UserID:  userID,
+		Details: map[string]string{"mode": input.Mode},
+	})
+	metrics.AccountsDeleted.WithLabelValues(input.Mode).Inc()
+	metrics.HttpRequests.WithLabelValues("/account/delete", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/account/delete").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Account deleted",
+		"mode":            input.Mode,
+		"sessionsRevoked": revoked,
+		"services":        results,
+	})
+}
+
+// requestDeleteConfirmation mails a password-less account the token that
+// confirms its deletion, proving the request comes from whoever holds the
+// address as well as the session.
+func requestDeleteConfirmation(c *gin.Context, user *models.User) {
+	token, err := tokens.IssueOneTime(tokens.PurposeDeleteAccount, user.ID.Hex(), deleteConfirmTTL)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/account/delete", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create confirmation token"})
+		return
+	}
+
+	sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm the deletion of your Rysto account",
+		Body: "Someone asked to delete the Rysto account @" + user.Handle + ".\n\n" +
+			"Confirm the deletion here:\n\n" +
+			link("/account/delete/confirm", token) + "\n\n" +
+			"The link expires in an hour. If you did not ask for this, sign out all devices right away.",
+	})
+
+	metrics.HttpRequests.WithLabelValues("/account/delete", "202").Inc()
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check your email to confirm the deletion"})
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"authService.com/auth/audit"
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+	"authService.com/auth/sessions"
+
+	"rysto/pkg/token"
+)
+
+// GetUserRoles returns the roles of an account.
+func GetUserRoles(c *gin.Context) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := userCollection.FindOne(ctx, byID(c.Param("id"))).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		metrics.HttpRequests.WithLabelValues("/admin/roles", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/admin/roles", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/admin/roles", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/admin/roles").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"id": user.ID.Hex(), "handle": user.Handle, "roles": user.Roles})
+}
+
+// GrantRole adds a role to an account. It shows up in the user's tokens from
+// their next refresh on.
+func GrantRole(c *gin.Context) {
+	start := time.Now()
+
+	role := c.Param("role")
+	if !token.ValidRole(role) {
+		metrics.HttpRequests.WithLabelValues("/admin/roles/grant", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+
+	user, ok := updateUser(c, "/admin/roles/grant", bson.M{"$addToSet": bson.M{"roles": role}})
+	if !ok {
+		return
+	}
+
+	recordEvent(c, audit.Event{
+		Type:    audit.TypeRoleGranted,
+		UserID:  user.ID.Hex(),
+		Details: map[string]string{"role": role},
+	})
+	metrics.RoleChanges.WithLabelValues("grant", role).Inc()
+	metrics.HttpRequests.WithLabelValues("/admin/roles/grant", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/admin/roles/grant").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"id": user.ID.Hex(), "handle": user.Handle, "roles": user.Roles})
+}
+
+// RevokeRole removes a role from an account and ends its sessions, so no
+// token carrying the role outlives the change.
+func RevokeRole(c *gin.Context) {
+	start := time.Now()
+
+	role := c.Param("role")
+	if !token.ValidRole(role) {
+		metrics.HttpRequests.WithLabelValues("/admin/roles/revoke", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+	if role == token.RoleUser {
+		metrics.HttpRequests.WithLabelValues("/admin/roles/revoke", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The user role cannot be revoked"})
+		return
+	}
+	if role == token.RoleAdmin && c.Param("id") == c.GetString("userId") {
+		metrics.HttpRequests.WithLabelValues("/admin/roles/revoke", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admins cannot revoke their own admin role"})
+		return
+	}
+
+	user, ok := updateUser(c, "/admin/roles/revoke", bson.M{"$pull": bson.M{"roles": role}})
+	if !ok {
+		return
+	}
+
+	revoked, err := sessions.RevokeAll(user.ID.Hex())
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/admin/roles/revoke", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Role revoked but failed to end the user's sessions"})
+		return
+	}
+
+	recordEvent(c, audit.Event{
+		Type:    audit.TypeRoleRevoked,
+		UserID:  user.ID.Hex(),
+		Details: map[string]string{"role": role, "sessionsRevoked": strconv.Itoa(revoked)},
+	})
+	metrics.RoleChanges.WithLabelValues("revoke", role).Inc()
+	metrics.HttpRequests.WithLabelValues("/admin/roles/revoke", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/admin/roles/revoke").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"id": user.ID.Hex(), "handle": user.Handle, "roles": user.Roles, "sessionsRevoked": revoked})
+}
+
+// updateUser applies update to the account named in the path and returns
+// the updated document. On failure it has already written the response.
+func updateUser(c *gin.Context, path string, update bson.M) (*models.User, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := userCollection.FindOneAndUpdate(ctx,
+		byID(c.Param("id")),
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		metrics.HttpRequests.WithLabelValues(path, "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues(path, "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return nil, false
+	}
+	return &user, true
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"authService.com/auth/apikeys"
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+
+	"rysto/pkg/token"
+)
+
+const (
+	maxAPIKeyNameLength = 64
+	maxAPIKeyDays       = 365
+)
+
+type CreateAPIKeyInput struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays"` // optional, 0 means the key never expires
+}
+
+// CreateAPIKey issues a named, scoped API key for the logged-in user. The key
+// is shown once and only its digest is kept.
+func CreateAPIKey(c *gin.Context) {
+	start := time.Now()
+
+	var input CreateAPIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/keys/create", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxAPIKeyNameLength {
+		metrics.HttpRequests.WithLabelValues("/keys/create", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be 1-64 characters"})
+		return
+	}
+	scopes, ok := normalizeScopes(input.Scopes)
+	if !ok {
+		metrics.HttpRequests.WithLabelValues("/keys/create", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope", "validScopes": validScopes()})
+		return
+	}
+	if input.ExpiresInDays < 0 || input.ExpiresInDays > maxAPIKeyDays {
+		metrics.HttpRequests.WithLabelValues("/keys/create", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresInDays must be between 0 and 365"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, currentUser(c)).Decode(&user); err != nil {
+		metrics.HttpRequests.WithLabelValues("/keys/create", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	// Keys pass RequireVerified in the other services, so only verified
+	// accounts may create them.
+	if !user.Verified {
+		metrics.HttpRequests.WithLabelValues("/keys/create", "403").Inc()
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		return
+	}
+
+	ttl := time.Duration(input.ExpiresInDays) * 24 * time.Hour
+	raw, key, err := apikeys.Create(ctx, user.ID.Hex(), user.Handle, name, scopes, ttl)
+	if err == apikeys.ErrTooMany {
+		metrics.HttpRequests.WithLabelValues("/keys/create", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Too many API keys; revoke one first"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/keys/create", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	metrics.APIKeyChanges.WithLabelValues("created").Inc()
+	metrics.HttpRequests.WithLabelValues("/keys/create", "201").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/keys/create").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusCreated, gin.H{
+		"key":     raw,
+		"apiKey":  key,
+		"message": "Store this key now; it will not be shown again",
+	})
+}
+
+// ListAPIKeys returns the logged-in user's API keys without their secrets.
+func ListAPIKeys(c *gin.Context) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	list, err := apikeys.List(ctx, c.GetString("userId"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/keys", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load API keys"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/keys", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/keys").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, list)
+}
+
+// RevokeAPIKey deletes one of the logged-in user's API keys.
+func RevokeAPIKey(c *gin.Context) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := apikeys.Revoke(ctx, c.GetString("userId"), c.Param("id"))
+	if err == apikeys.ErrNotFound {
+		metrics.HttpRequests.WithLabelValues("/keys/revoke", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/keys/revoke", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	metrics.APIKeyChanges.WithLabelValues("revoked").Inc()
+	metrics.HttpRequests.WithLabelValues("/keys/revoke", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/keys/revoke").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// normalizeScopes deduplicates scopes and reports whether all are known.
+func normalizeScopes(scopes []string) ([]string, bool) {
+	seen := map[string]bool{}
+	var out []string
+	for _, s := range scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if !token.ValidScope(s) {
+			return nil, false
+		}
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out, len(out) > 0
+}
+
+func validScopes() []string {
+	return []string{token.ScopeStoriesRead, token.ScopeStoriesWrite, token.ScopeVotesRead, token.ScopeVotesWrite}
+}
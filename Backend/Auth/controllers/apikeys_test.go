@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		want   []string
+		wantOK bool
+	}{
+		{name: "known scopes", scopes: []string{"stories:read", "votes:write"}, want: []string{"stories:read", "votes:write"}, wantOK: true},
+		{name: "case and spaces", scopes: []string{" Stories:Read ", "VOTES:READ"}, want: []string{"stories:read", "votes:read"}, wantOK: true},
+		{name: "duplicates keep first order", scopes: []string{"votes:read", "stories:write", "votes:read", "Stories:Write"}, want: []string{"votes:read", "stories:write"}, wantOK: true},
+		{name: "unknown scope", scopes: []string{"stories:read", "admin"}},
+		{name: "OpenID scope is not a Rysto scope", scopes: []string{"openid"}},
+		{name: "empty scope", scopes: []string{""}},
+		{name: "none", scopes: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := normalizeScopes(tt.scopes)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeScopes(%q) = (%q, %v), want (%q, %v)", tt.scopes, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
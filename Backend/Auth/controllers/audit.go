@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"authService.com/auth/audit"
+	"authService.com/auth/metrics"
+)
+
+const (
+	defaultEventsLimit = 50
+	maxEventsLimit     = 200
+)
+
+// recordEvent appends e to the audit log with the client's IP and user
+// agent. When the caller acts on someone else's account they are recorded
+// as the actor; otherwise the caller's session is.
+func recordEvent(c *gin.Context, e audit.Event) {
+	e.IP = c.ClientIP()
+	e.UserAgent = c.Request.UserAgent()
+	if caller := c.GetString("userId"); caller != "" && caller != e.UserID {
+		e.ActorID = caller
+	} else if e.SessionID == "" {
+		e.SessionID = c.GetString("sessionId")
+	}
+	audit.Record(e)
+}
+
+// ListSecurityEvents returns the logged-in user's security history, newest
+// first. Pages continue with ?before=<next>.
+func ListSecurityEvents(c *gin.Context) {
+	start := time.Now()
+
+	filter, err := eventFilter(c)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/security/events", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.UserID = c.GetString("userId")
+	filter.IP = ""
+
+	events, ok := queryEvents(c, "/security/events", filter)
+	if !ok {
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/security/events", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/security/events").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, eventsPage(events, filter.Limit))
+}
+
+// AdminListSecurityEvents searches the audit log of every account by userId,
+// type, ip and a since/until time range (RFC 3339).
+func AdminListSecurityEvents(c *gin.Context) {
+	start := time.Now()
+
+	filter, err := eventFilter(c)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/admin/security/events", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, ok := queryEvents(c, "/admin/security/events", filter)
+	if !ok {
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/admin/security/events", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/admin/security/events").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, eventsPage(events, filter.Limit))
+}
+
+// eventFilter reads the query parameters shared by both event listings.
+func eventFilter(c *gin.Context) (audit.Filter, error) {
+	f := audit.Filter{
+		UserID: c.Query("userId"),
+		Type:   c.Query("type"),
+		IP:     c.Query("ip"),
+		Limit:  defaultEventsLimit,
+	}
+
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > maxEventsLimit {
+			return f, errors.New("limit must be between 1 and 200")
+		}
+		f.Limit = n
+	}
+	if v := c.Query("before"); v != "" {
+		id, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			return f, errors.New("invalid before cursor")
+		}
+		f.Before = id
+	}
+	for name, dst := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, errors.New(name + " must be an RFC 3339 time")
+			}
+			*dst = t
+		}
+	}
+	return f, nil
+}
+
+// queryEvents runs f. On failure it has already written the response.
+func queryEvents(c *gin.Context, path string, f audit.Filter) ([]audit.Event, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events, err := audit.Query(ctx, f)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues(path, "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load security events"})
+		return nil, false
+	}
+	return events, true
+}
+
+// eventsPage wraps events with the cursor of the next page, if there may be
+// one.
+func eventsPage(events []audit.Event, limit int64) gin.H {
+	page := gin.H{"events": events}
+	if int64(len(events)) == limit {
+		page["next"] = events[len(events)-1].ID.Hex()
+	}
+	return page
+}
@@ -8,13 +8,20 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/crypto/bcrypt"
 
+	"authService.com/auth/audit"
 	"authService.com/auth/models"
-	"authService.com/auth/redis"
+	"authService.com/auth/passwords"
+	"authService.com/auth/registration"
+	"authService.com/auth/sessions"
+	"authService.com/auth/tokens"
 	"authService.com/auth/utils"
 	"authService.com/auth/metrics" // <-- new import for Prometheus metrics
+
+	"rysto/pkg/redis"
+	"rysto/pkg/token"
 )
 
 var userCollection *mongo.Collection
@@ -23,9 +30,26 @@ func SetUserCollection(collection *mongo.Collection) {
 	userCollection = collection
 }
 
+// byID returns a filter matching the user with the given hex ID. An invalid
+// ID matches no document.
+func byID(id string) bson.M {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return bson.M{"_id": primitive.NilObjectID}
+	}
+	return bson.M{"_id": oid}
+}
+
+// currentUser returns a filter matching the logged-in user.
+func currentUser(c *gin.Context) bson.M {
+	return byID(c.GetString("userId"))
+}
+
 type RegisterInput struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required,min=6"`
+	Handle     string `json:"handle"`     // optional, derived from the email when empty
+	InviteCode string `json:"inviteCode"` // required unless registration is open to the address
 }
 
 type LoginInput struct {
@@ -33,9 +57,20 @@ type LoginInput struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// TwoFactorChallengeResponse is returned by Login instead of tokens when the
+// account has two-factor authentication enabled.
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+	ExpiresIn         int    `json:"expiresIn"`
+	Message           string `json:"message"`
+}
+
 type LoginResponse struct {
-	Token   string `json:"token"`
-	Message string `json:"message"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+	Message      string `json:"message"`
 }
 
 // Register handles user registration
@@ -49,6 +84,16 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	handle := models.NormalizeHandle(input.Handle)
+	if handle != "" && !models.ValidHandle(handle) {
+		metrics.HttpRequests.WithLabelValues("/register", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Handle must be 3-30 lowercase letters, digits or underscores"})
+		return
+	}
+	if breachedPassword(c, "/register", input.Password) {
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -64,29 +109,101 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	// A code is checked whenever one is given, even where it is not needed.
+	var invite *models.Invite
+	if input.InviteCode == "" && registration.NeedsInvite(input.Email) {
+		metrics.HttpRequests.WithLabelValues("/register", "403").Inc()
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration requires an invite code"})
+		return
+	}
+	if input.InviteCode != "" {
+		invite, err = redeemInvite(ctx, input.InviteCode)
+		if err == errInvalidInvite {
+			metrics.HttpRequests.WithLabelValues("/register", "403").Inc()
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid, expired or used-up invite code"})
+			return
+		}
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/register", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check invite code"})
+			return
+		}
+	}
+
+	// Hashed only once the invite let the registration through, as hashing
+	// is the slow part.
+	hashedPassword, err := passwords.Hash(input.Password)
 	if err != nil {
+		if invite != nil {
+			releaseInvite(ctx, invite)
+		}
 		metrics.HttpRequests.WithLabelValues("/register", "500").Inc()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
 
 	user := models.User{
-		Email:    input.Email,
-		Password: string(hashedPassword),
+		Email:     input.Email,
+		Password:  hashedPassword,
+		Roles:     []string{token.RoleUser},
+		Handle:    handle,
+		CreatedAt: time.Now(),
+	}
+	if invite != nil {
+		user.InvitedBy = invite.CreatedBy
 	}
 
-	_, err = userCollection.InsertOne(ctx, user)
+	// A handle the user picked must be free; a derived one is retried with a
+	// random suffix until it is.
+	for attempt := 0; ; attempt++ {
+		if handle == "" {
+			user.Handle = models.DeriveHandle(input.Email, attempt)
+		}
+		var res *mongo.InsertOneResult
+		res, err = userCollection.InsertOne(ctx, user)
+		if err == nil {
+			user.ID = res.InsertedID.(primitive.ObjectID)
+		}
+		if !mongo.IsDuplicateKeyError(err) || models.DuplicateEmail(err) || handle != "" || attempt >= 10 {
+			break
+		}
+	}
+	if err != nil && invite != nil {
+		releaseInvite(ctx, invite)
+	}
+	// Someone registered the address since it was checked.
+	if models.DuplicateEmail(err) {
+		metrics.HttpRequests.WithLabelValues("/register", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+	if mongo.IsDuplicateKeyError(err) && handle != "" {
+		metrics.HttpRequests.WithLabelValues("/register", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Handle already taken"})
+		return
+	}
 	if err != nil {
 		metrics.HttpRequests.WithLabelValues("/register", "500").Inc()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
+	if err := sendVerificationEmail(user.Email); err != nil {
+		log.Printf("Register: failed to issue verification token: %v", err)
+	}
+	event := audit.Event{Type: audit.TypeRegistered, UserID: user.ID.Hex(), Email: user.Email}
+	if invite != nil {
+		event.Details = map[string]string{"invitedBy": invite.CreatedBy, "inviteId": invite.ID.Hex()}
+	}
+	recordEvent(c, event)
+
 	metrics.HttpRequests.WithLabelValues("/register", "201").Inc()
 	metrics.HttpRequestDuration.WithLabelValues("/register").Observe(time.Since(start).Seconds())
 
-	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully"})
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "User registered successfully. Check your email to verify your address.",
+		"handle":  user.Handle,
+	})
 }
 
 // Login authenticates a user and stores the token in Redis
@@ -101,6 +218,10 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	if throttled(c, "/login", input.Email) {
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -108,7 +229,7 @@ func Login(c *gin.Context) {
 	err := userCollection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			metrics.FailedLogins.Inc()
+			loginFailed(c, input.Email, "", "unknown_account")
 			metrics.HttpRequests.WithLabelValues("/login", "401").Inc()
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		} else {
@@ -118,39 +239,101 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password))
-	if err != nil {
-		metrics.FailedLogins.Inc()
+	if !checkPassword(&user, input.Password) {
+		loginFailed(c, input.Email, user.ID.Hex(), "wrong_password")
 		metrics.HttpRequests.WithLabelValues("/login", "401").Inc()
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
+	upgradePasswordHash(ctx, &user, input.Password)
 
-	token, err := utils.GenerateToken(user.Email)
-	if err != nil {
-		metrics.HttpRequests.WithLabelValues("/login", "500").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+	// Checked after the password, so the status is only told to the owner.
+	if refuseRestricted(c, "/login", &user) {
 		return
 	}
 
-	// Store token in Redis with expiration
-	tokenTTL := 24 * time.Hour
-	err = redis.Client.Set(redis.Ctx, token, user.Email, tokenTTL).Err()
+	if user.TOTPEnabled {
+		challenge, err := tokens.IssueChallenge(user.ID.Hex())
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/login", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create login challenge"})
+			return
+		}
+
+		metrics.HttpRequests.WithLabelValues("/login", "200").Inc()
+		metrics.HttpRequestDuration.WithLabelValues("/login").Observe(time.Since(start).Seconds())
+		c.JSON(http.StatusOK, TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresIn:         int(tokens.ChallengeTTL.Seconds()),
+			Message:           "Two-factor code required",
+		})
+		return
+	}
+
+	resp, err := startSession(c, &user, "password")
 	if err != nil {
 		metrics.HttpRequests.WithLabelValues("/login", "500").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
 		return
 	}
 
+	loginSucceeded(user.Email)
 	metrics.SuccessfulLogins.Inc()
-	metrics.ActiveSessions.Inc()
 	metrics.HttpRequests.WithLabelValues("/login", "200").Inc()
 	metrics.HttpRequestDuration.WithLabelValues("/login").Observe(time.Since(start).Seconds())
 
-	c.JSON(http.StatusOK, LoginResponse{
-		Token:   token,
-		Message: "Login successful",
+	c.JSON(http.StatusOK, resp)
+}
+
+// startSession opens a new session for user, records the sign-in made with
+// method and returns the session's first token pair.
+func startSession(c *gin.Context, user *models.User, method string) (*LoginResponse, error) {
+	userID := user.ID.Hex()
+
+	sessionID, err := sessions.Create(userID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := tokens.Issue(sessionID, userID)
+	if err != nil {
+		_ = sessions.Revoke(userID, sessionID)
+		return nil, err
+	}
+
+	token, err := issueAccessToken(user, sessionID)
+	if err != nil {
+		_ = sessions.Revoke(userID, sessionID)
+		return nil, err
+	}
+
+	recordEvent(c, audit.Event{
+		Type:      audit.TypeLoginSucceeded,
+		UserID:    userID,
+		SessionID: sessionID,
+		Details:   map[string]string{"method": method},
 	})
+
+	return &LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+		Message:      "Login successful",
+	}, nil
+}
+
+// issueAccessToken signs an access token for the session and stores it in
+// Redis for as long as the JWT itself is valid.
+func issueAccessToken(user *models.User, sessionID string) (string, error) {
+	token, err := utils.GenerateToken(user, sessionID)
+	if err != nil {
+		return "", err
+	}
+	if err := sessions.BindAccessToken(sessionID, user.ID.Hex(), token, utils.AccessTokenTTL); err != nil {
+		return "", err
+	}
+	return token, nil
 }
 
 func Logout(c *gin.Context) {
@@ -164,16 +347,25 @@ func Logout(c *gin.Context) {
 		return
 	}
 
-	log.Printf("Logout: token to delete: %s", token.(string))
-
-	err := redis.Client.Del(redis.Ctx, token.(string)).Err()
+	// Revoking the session also deletes the access token bound to it and
+	// every refresh token of its family.
+	var err error
+	if id := c.GetString("sessionId"); id != "" {
+		err = sessions.Revoke(c.GetString("userId"), id)
+		if err == sessions.ErrNotFound {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = redis.Client.Del(redis.Ctx, token.(string)).Err()
+	}
 	if err != nil {
 		metrics.HttpRequests.WithLabelValues("/logout", "500").Inc()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invalidate token"})
 		return
 	}
+	recordEvent(c, audit.Event{Type: audit.TypeLogout, UserID: c.GetString("userId")})
 
-	metrics.ActiveSessions.Dec()
 	metrics.HttpRequests.WithLabelValues("/logout", "200").Inc()
 	metrics.HttpRequestDuration.WithLabelValues("/logout").Observe(time.Since(start).Seconds())
 
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"authService.com/auth/mailer"
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+	"authService.com/auth/sessions"
+	"authService.com/auth/tokens"
+)
+
+// emailChangeTTL is how long the confirmation link for a new address stays
+// valid.
+const emailChangeTTL = 24 * time.Hour
+
+type ChangeEmailInput struct {
+	NewEmail string `json:"newEmail" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ConfirmEmailChangeInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// emailChangeValue packs what the confirmation needs into the token value:
+// the user, the session that asked (it survives the change) and the new
+// address. The address goes last since it is the only part that may contain
+// the separator.
+func emailChangeValue(userID, sessionID, newEmail string) string {
+	return userID + "|" + sessionID + "|" + newEmail
+}
+
+func parseEmailChangeValue(v string) (userID, sessionID, newEmail string, ok bool) {
+	parts := strings.SplitN(v, "|", 3)
+	if len(parts) != 3 {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
+// emailTaken reports whether any account uses email.
+func emailTaken(ctx context.Context, email string) (bool, error) {
+	count, err := userCollection.CountDocuments(ctx, bson.M{"email": email})
+	return count > 0, err
+}
+
+// ChangeEmail starts moving the logged-in user to a new email address. The
+// change only happens once the link sent to the new address is followed; the
+// old address is told about the request.
+func ChangeEmail(c *gin.Context) {
+	start := time.Now()
+
+	var input ChangeEmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/email/change", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, currentUser(c)).Decode(&user); err != nil {
+		metrics.HttpRequests.WithLabelValues("/email/change", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !checkPassword(&user, input.Password) {
+		metrics.HttpRequests.WithLabelValues("/email/change", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	if strings.EqualFold(input.NewEmail, user.Email) {
+		metrics.HttpRequests.WithLabelValues("/email/change", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New email is the same as the current one"})
+		return
+	}
+
+	taken, err := emailTaken(ctx, input.NewEmail)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/email/change", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking email availability"})
+		return
+	}
+	if taken {
+		metrics.HttpRequests.WithLabelValues("/email/change", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	value := emailChangeValue(user.ID.Hex(), c.GetString("sessionId"), input.NewEmail)
+	token, err := tokens.IssueOneTime(tokens.PurposeEmailChange, value, emailChangeTTL)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/email/change", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create confirmation token"})
+		return
+	}
+
+	sendMail(mailer.Message{
+		To:      input.NewEmail,
+		Subject: "Confirm your new Rysto email address",
+		Body: "Someone asked to use this address for the Rysto account @" + user.Handle + ".\n\n" +
+			"Confirm the change here:\n\n" +
+			link("/email/confirm", token) + "\n\n" +
+			"The link expires in 24 hours. If you did not ask for this, ignore this email.",
+	})
+	sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Rysto email address is about to change",
+		Body: "Someone asked to change the email address of your Rysto account to " + input.NewEmail + ".\n\n" +
+			"Nothing changes until the new address is confirmed. " +
+			"If this was not you, change your password and sign out all devices right away.",
+	})
+
+	metrics.HttpRequests.WithLabelValues("/email/change", "202").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/email/change").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check your new email address to confirm the change"})
+}
+
+// ConfirmEmailChange applies an email change using the token sent to the new
+// address and signs out every other session of the account.
+func ConfirmEmailChange(c *gin.Context) {
+	start := time.Now()
+
+	var input ConfirmEmailChangeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/email/confirm", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	value, err := tokens.ConsumeOneTime(tokens.PurposeEmailChange, input.Token)
+	if err != nil && err != tokens.ErrInvalidToken {
+		metrics.HttpRequests.WithLabelValues("/email/confirm", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+	userID, sessionID, newEmail, ok := parseEmailChangeValue(value)
+	if err == tokens.ErrInvalidToken || !ok {
+		metrics.HttpRequests.WithLabelValues("/email/confirm", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation token"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The address may have been registered since the change was requested;
+	// the unique index catches a registration racing this check.
+	taken, err := emailTaken(ctx, newEmail)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/email/confirm", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking email availability"})
+		return
+	}
+	if taken {
+		metrics.HttpRequests.WithLabelValues("/email/confirm", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	// Following the link proves the new address, so it counts as verified.
+	res, err := userCollection.UpdateOne(ctx, byID(userID), bson.M{"$set": bson.M{
+		"email":      newEmail,
+		"verified":   true,
+		"verifiedAt": time.Now(),
+	}})
+	if models.DuplicateEmail(err) {
+		metrics.HttpRequests.WithLabelValues("/email/confirm", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/email/confirm", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		metrics.HttpRequests.WithLabelValues("/email/confirm", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account no longer exists"})
+		return
+	}
+
+	revoked, err := sessions.RevokeOthers(userID, sessionID)
+	if err != nil {
+		log.Printf("ConfirmEmailChange: failed to revoke sessions of %s: %v", userID, err)
+	}
+
+	metrics.EmailChanges.Inc()
+	metrics.HttpRequests.WithLabelValues("/email/confirm", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/email/confirm").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Email changed. Refresh your session to pick up the new address.",
+		"sessionsRevoked": revoked,
+	})
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"authService.com/auth/exports"
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+)
+
+// exportResponse is a job plus the links to poll and download it.
+type exportResponse struct {
+	*exports.Job
+	StatusURL   string `json:"statusUrl"`
+	DownloadURL string `json:"downloadUrl,omitempty"`
+}
+
+func newExportResponse(job *exports.Job) exportResponse {
+	resp := exportResponse{Job: job, StatusURL: "/api/export/" + job.ID}
+	if job.Status == exports.StatusReady {
+		resp.DownloadURL = resp.StatusURL + "/download"
+	}
+	return resp
+}
+
+// RequestExport starts building a data export of the logged-in user's
+// account, stories, continuations and votes.
+func RequestExport(c *gin.Context) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, currentUser(c)).Decode(&user); err != nil {
+		metrics.HttpRequests.WithLabelValues("/export", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	job, created, err := exports.Create(user.ID.Hex())
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/export", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create export"})
+		return
+	}
+	if created {
+		exports.Start(job, &user)
+		metrics.ExportsRequested.Inc()
+	}
+
+	metrics.HttpRequests.WithLabelValues("/export", "202").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/export").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusAccepted, newExportResponse(job))
+}
+
+// loadExport returns the caller's export named in the path. On failure it has
+// already written the response.
+func loadExport(c *gin.Context, path string) (*exports.Job, bool) {
+	job, err := exports.Get(c.Param("id"))
+	if err == exports.ErrNotFound || (err == nil && job.UserID != c.GetString("userId")) {
+		metrics.HttpRequests.WithLabelValues(path, "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return nil, false
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues(path, "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load export"})
+		return nil, false
+	}
+	return job, true
+}
+
+// GetExport reports the status of one of the logged-in user's exports.
+func GetExport(c *gin.Context) {
+	start := time.Now()
+
+	job, ok := loadExport(c, "/export/status")
+	if !ok {
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/export/status", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/export/status").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, newExportResponse(job))
+}
+
+// DownloadExport sends a finished export as a ZIP file.
+func DownloadExport(c *gin.Context) {
+	start := time.Now()
+
+	job, ok := loadExport(c, "/export/download")
+	if !ok {
+		return
+	}
+	if job.Status != exports.StatusReady {
+		metrics.HttpRequests.WithLabelValues("/export/download", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is not ready", "status": job.Status})
+		return
+	}
+
+	path := exports.Path(job.ID)
+	if _, err := os.Stat(path); err != nil {
+		metrics.HttpRequests.WithLabelValues("/export/download", "410").Inc()
+		c.JSON(http.StatusGone, gin.H{"error": "Export has expired, please request a new one"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/export/download", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/export/download").Observe(time.Since(start).Seconds())
+	c.FileAttachment(path, "rysto-export-"+job.CreatedAt.Format("2006-01-02")+".zip")
+}
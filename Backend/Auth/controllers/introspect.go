@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+
+	"authService.com/auth/metrics"
+	"authService.com/auth/utils"
+
+	"rysto/pkg/apikey"
+	"rysto/pkg/introspect"
+	pkgmiddleware "rysto/pkg/middleware"
+	"rysto/pkg/redis"
+	"rysto/pkg/token"
+	"rysto/pkg/userstatus"
+)
+
+var introspectionSecret string
+
+// SetIntrospectionSecret sets the secret services present to /introspect.
+// Without one the endpoint is disabled.
+func SetIntrospectionSecret(secret string) {
+	introspectionSecret = secret
+}
+
+// IntrospectToken tells another service whether an access token or API key
+// is active, expired or revoked, with its claims while it is active, so the
+// service does not have to read Auth's Redis keys itself.
+func IntrospectToken(c *gin.Context) {
+	start := time.Now()
+	c.Header("Cache-Control", "no-store")
+
+	if introspectionSecret == "" {
+		metrics.HttpRequests.WithLabelValues("/introspect", "503").Inc()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Introspection is disabled"})
+		return
+	}
+	secret := token.ExtractBearer(c.GetHeader("Authorization"))
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(introspectionSecret)) != 1 {
+		metrics.HttpRequests.WithLabelValues("/introspect", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid service credentials"})
+		return
+	}
+
+	var input introspect.Request
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/introspect", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var (
+		resp *introspect.Response
+		err  error
+	)
+	if strings.HasPrefix(input.Token, apikey.Prefix) {
+		resp, err = introspectAPIKey(ctx, input.Token)
+	} else {
+		resp, err = introspectAccessToken(ctx, input.Token)
+	}
+	if err != nil {
+		log.Printf("IntrospectToken: %v", err)
+		metrics.HttpRequests.WithLabelValues("/introspect", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to introspect token"})
+		return
+	}
+
+	metrics.Introspections.WithLabelValues(resp.Status).Inc()
+	metrics.HttpRequests.WithLabelValues("/introspect", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/introspect").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, resp)
+}
+
+// introspectAccessToken checks the signature and expiry of raw, then whether
+// it is still in Redis, which logout and session revocation undo, and
+// whether its owner is suspended or banned.
+func introspectAccessToken(ctx context.Context, raw string) (*introspect.Response, error) {
+	claims, err := utils.Validator().Inspect(raw)
+	if errors.Is(err, token.ErrExpired) {
+		return &introspect.Response{Status: introspect.StatusExpired}, nil
+	}
+	if err != nil || claims.Subject == "" {
+		return &introspect.Response{Status: introspect.StatusInvalid}, nil
+	}
+
+	owner, err := redis.Client.Get(ctx, raw).Result()
+	if err == goredis.Nil || (err == nil && owner != claims.Subject) {
+		return &introspect.Response{Status: introspect.StatusRevoked}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := userstatus.Lookup(ctx, redis.Client, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if status != nil {
+		return &introspect.Response{Status: status.State, Restriction: status}, nil
+	}
+	return &introspect.Response{Active: true, Status: introspect.StatusActive, Claims: claims}, nil
+}
+
+// introspectAPIKey resolves an API key. Revoked and expired keys are deleted,
+// so they are indistinguishable from keys that never existed.
+func introspectAPIKey(ctx context.Context, key string) (*introspect.Response, error) {
+	claims, err := pkgmiddleware.RedisAPIKeys(redis.Client)(ctx, key)
+	if errors.Is(err, apikey.ErrNotFound) {
+		return &introspect.Response{Status: introspect.StatusInvalid}, nil
+	}
+	var restricted *userstatus.Error
+	if errors.As(err, &restricted) {
+		return &introspect.Response{Status: restricted.Status.State, Restriction: &restricted.Status}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &introspect.Response{Active: true, Status: introspect.StatusActive, Claims: claims, KeyID: claims.KeyID}, nil
+}
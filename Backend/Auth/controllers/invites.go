@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+	"authService.com/auth/registration"
+	"authService.com/auth/totp"
+
+	"rysto/pkg/token"
+)
+
+// Limits on invites. Admins invite whole groups; users a few friends.
+const (
+	defaultInviteTTL   = 7 * 24 * time.Hour
+	maxUserInviteUses  = 10
+	maxUserInviteTTL   = 30 * 24 * time.Hour
+	maxUserInvites     = 10 // unexpired invites per user
+	maxAdminInviteUses = 1000
+	maxAdminInviteTTL  = 365 * 24 * time.Hour
+	inviteCodeLength   = 10
+	maxListedInvitees  = 100
+)
+
+var errInvalidInvite = errors.New("invalid, expired or used-up invite code")
+
+var inviteCollection *mongo.Collection
+
+// SetInviteCollection injects the collection of invite codes.
+func SetInviteCollection(collection *mongo.Collection) {
+	inviteCollection = collection
+}
+
+type CreateInviteInput struct {
+	MaxUses        int `json:"maxUses" binding:"omitempty,min=1"`
+	ExpiresInHours int `json:"expiresInHours" binding:"omitempty,min=1"`
+}
+
+// normalizeInviteCode makes invite codes case- and dash-insensitive.
+func normalizeInviteCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// generateInviteCode returns a fresh code. Codes use the base32 alphabet, so
+// they survive being read out or typed by hand.
+func generateInviteCode() (string, error) {
+	raw, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+	return normalizeInviteCode(raw)[:inviteCodeLength], nil
+}
+
+// redeemInvite uses up one registration of code and returns the invite.
+func redeemInvite(ctx context.Context, code string) (*models.Invite, error) {
+	var invite models.Invite
+	err := inviteCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"code":      normalizeInviteCode(code),
+			"expiresAt": bson.M{"$gt": time.Now()},
+			"$expr":     bson.M{"$lt": bson.A{"$uses", "$maxUses"}},
+		},
+		bson.M{"$inc": bson.M{"uses": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&invite)
+	if err == mongo.ErrNoDocuments {
+		return nil, errInvalidInvite
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// releaseInvite gives back a registration taken by redeemInvite when the
+// account could not be created after all.
+func releaseInvite(ctx context.Context, invite *models.Invite) {
+	_, _ = inviteCollection.UpdateOne(ctx,
+		bson.M{"_id": invite.ID, "uses": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"uses": -1}})
+}
+
+// RegistrationMode tells clients whether the sign-up form needs an invite
+// code.
+func RegistrationMode(c *gin.Context) {
+	mode := registration.Mode()
+	metrics.HttpRequests.WithLabelValues("/register/mode", "200").Inc()
+	c.JSON(http.StatusOK, gin.H{
+		"mode":           mode,
+		"inviteRequired": mode == registration.ModeInvite,
+	})
+}
+
+// CreateInvite creates an invite code owned by the logged-in user. Admins may
+// create codes with more uses and a longer lifetime.
+func CreateInvite(c *gin.Context) {
+	start := time.Now()
+
+	var input CreateInviteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/invites/create", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, _ := c.Get("claims")
+	admin := claims != nil && claims.(*token.Claims).HasRole(token.RoleAdmin)
+	if !admin && !registration.UserInvites() {
+		metrics.HttpRequests.WithLabelValues("/invites/create", "403").Inc()
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create invites"})
+		return
+	}
+	if !admin && !c.GetBool("emailVerified") {
+		metrics.HttpRequests.WithLabelValues("/invites/create", "403").Inc()
+		c.JSON(http.StatusForbidden, gin.H{"error": "Verify your email address before inviting others"})
+		return
+	}
+
+	maxUses, maxTTL := maxUserInviteUses, maxUserInviteTTL
+	if admin {
+		maxUses, maxTTL = maxAdminInviteUses, maxAdminInviteTTL
+	}
+	if input.MaxUses == 0 {
+		input.MaxUses = 1
+	}
+	ttl := defaultInviteTTL
+	if input.ExpiresInHours > 0 {
+		ttl = time.Duration(input.ExpiresInHours) * time.Hour
+	}
+	if input.MaxUses > maxUses || ttl > maxTTL {
+		metrics.HttpRequests.WithLabelValues("/invites/create", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "Invite exceeds the allowed uses or lifetime",
+			"maxUses":           maxUses,
+			"maxExpiresInHours": int(maxTTL.Hours()),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userID := c.GetString("userId")
+	if !admin {
+		count, err := inviteCollection.CountDocuments(ctx, bson.M{"createdBy": userID, "expiresAt": bson.M{"$gt": time.Now()}})
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/invites/create", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if count >= maxUserInvites {
+			metrics.HttpRequests.WithLabelValues("/invites/create", "409").Inc()
+			c.JSON(http.StatusConflict, gin.H{"error": "Too many open invites; revoke one first"})
+			return
+		}
+	}
+
+	now := time.Now()
+	invite := models.Invite{
+		CreatedBy: userID,
+		MaxUses:   input.MaxUses,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if invite.Code, err = generateInviteCode(); err != nil {
+			break
+		}
+		if _, err = inviteCollection.InsertOne(ctx, invite); !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/invites/create", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	metrics.InvitesCreated.Inc()
+	metrics.HttpRequests.WithLabelValues("/invites/create", "201").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/invites/create").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusCreated, invite)
+}
+
+// ListInvites returns the logged-in user's invites and the accounts that
+// registered with them.
+func ListInvites(c *gin.Context) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userID := c.GetString("userId")
+	cursor, err := inviteCollection.Find(ctx, bson.M{"createdBy": userID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/invites", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load invites"})
+		return
+	}
+	invites := []models.Invite{}
+	if err := cursor.All(ctx, &invites); err != nil {
+		metrics.HttpRequests.WithLabelValues("/invites", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load invites"})
+		return
+	}
+
+	cursor, err = userCollection.Find(ctx, bson.M{"invitedBy": userID},
+		options.Find().
+			SetProjection(bson.M{"handle": 1, "createdAt": 1}).
+			SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+			SetLimit(maxListedInvitees))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/invites", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load invites"})
+		return
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		metrics.HttpRequests.WithLabelValues("/invites", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load invites"})
+		return
+	}
+	invitees := make([]gin.H, 0, len(users))
+	for _, u := range users {
+		invitees = append(invitees, gin.H{"handle": u.Handle, "joinedAt": u.CreatedAt})
+	}
+
+	metrics.HttpRequests.WithLabelValues("/invites", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/invites").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"invites": invites, "invitees": invitees})
+}
+
+// RevokeInvite deletes an invite code so nobody else can register with it.
+// Admins may revoke anyone's.
+func RevokeInvite(c *gin.Context) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"code": normalizeInviteCode(c.Param("code"))}
+	claims, _ := c.Get("claims")
+	if claims == nil || !claims.(*token.Claims).HasRole(token.RoleAdmin) {
+		filter["createdBy"] = c.GetString("userId")
+	}
+
+	res, err := inviteCollection.DeleteOne(ctx, filter)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/invites/revoke", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite"})
+		return
+	}
+	if res.DeletedCount == 0 {
+		metrics.HttpRequests.WithLabelValues("/invites/revoke", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/invites/revoke", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/invites/revoke").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked"})
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"authService.com/auth/audit"
+	"authService.com/auth/mailer"
+	"authService.com/auth/metrics"
+	"authService.com/auth/ratelimit"
+	"authService.com/auth/tokens"
+)
+
+type UnlockInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// throttled answers 429 with Retry-After when the rate limiter refuses a login
+// attempt from this client for email. It reports whether the request was
+// handled.
+func throttled(c *gin.Context, path, email string) bool {
+	block, err := ratelimit.Check(c.ClientIP(), email)
+	if err != nil {
+		// Failing open keeps logins working while Redis hiccups; the
+		// session store would fail the login anyway if Redis is down.
+		log.Printf("ratelimit: check failed: %v", err)
+		return false
+	}
+	if block == nil {
+		return false
+	}
+
+	seconds := int(math.Ceil(block.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+
+	if block.Locked {
+		metrics.LoginsThrottled.WithLabelValues("lockout").Inc()
+		metrics.HttpRequests.WithLabelValues(path, "429").Inc()
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":      "Too many failed login attempts. Try again later or use the unlock link sent to your email.",
+			"retryAfter": seconds,
+		})
+		return true
+	}
+
+	metrics.LoginsThrottled.WithLabelValues("delay").Inc()
+	metrics.HttpRequests.WithLabelValues(path, "429").Inc()
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":      "Too many failed login attempts. Slow down.",
+		"retryAfter": seconds,
+	})
+	return true
+}
+
+// loginFailed records a failed attempt against email, whose account is userID
+// if it exists, in the rate limiter and the audit log. When it locks out the
+// email of an existing account, the owner gets a link to lift the lockout
+// early.
+func loginFailed(c *gin.Context, email, userID, reason string) {
+	metrics.FailedLogins.Inc()
+	recordEvent(c, audit.Event{
+		Type:    audit.TypeLoginFailed,
+		UserID:  userID,
+		Email:   email,
+		Details: map[string]string{"reason": reason},
+	})
+
+	locked, err := ratelimit.RecordFailure(c.ClientIP(), email)
+	if err != nil {
+		log.Printf("ratelimit: failed to record login failure: %v", err)
+	}
+
+	for _, scope := range locked {
+		metrics.AccountLockouts.WithLabelValues(scope).Inc()
+		if scope == ratelimit.ScopeEmail && userID != "" {
+			recordEvent(c, audit.Event{Type: audit.TypeLocked, UserID: userID, Email: email})
+			if err := sendUnlockEmail(email); err != nil {
+				log.Printf("Login: failed to issue unlock token: %v", err)
+			}
+		}
+	}
+}
+
+// loginSucceeded forgets the failures counted against email.
+func loginSucceeded(email string) {
+	if err := ratelimit.Reset(email); err != nil {
+		log.Printf("ratelimit: failed to reset failures: %v", err)
+	}
+}
+
+// sendUnlockEmail issues an unlock token for email and mails it.
+func sendUnlockEmail(email string) error {
+	ttl := ratelimit.LockoutDuration()
+	token, err := tokens.IssueOneTime(tokens.PurposeUnlock, email, ttl)
+	if err != nil {
+		return err
+	}
+
+	sendMail(mailer.Message{
+		To:      email,
+		Subject: "Your Rysto account has been locked",
+		Body: "We blocked sign-ins to your Rysto account after too many failed login attempts.\n\n" +
+			"If that was you, unlock your account now:\n\n" +
+			link("/login/unlock", token) + "\n\n" +
+			"Otherwise the lock lifts by itself in " + ttl.Round(time.Minute).String() + ". " +
+			"If you did not try to sign in, someone may be guessing your password; consider changing it.",
+	})
+	return nil
+}
+
+// UnlockAccount lifts a lockout using the token from the lockout email.
+func UnlockAccount(c *gin.Context) {
+	start := time.Now()
+
+	var input UnlockInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/login/unlock", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email, err := tokens.ConsumeOneTime(tokens.PurposeUnlock, input.Token)
+	if err == tokens.ErrInvalidToken {
+		metrics.HttpRequests.WithLabelValues("/login/unlock", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired unlock token"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/login/unlock", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+
+	if err := ratelimit.Unlock(email); err != nil {
+		metrics.HttpRequests.WithLabelValues("/login/unlock", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/login/unlock", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/login/unlock").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked. You can log in again."})
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"authService.com/auth/mailer"
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+	"authService.com/auth/ratelimit"
+	"authService.com/auth/tokens"
+)
+
+// magicLinkTTL is how long an emailed sign-in link stays valid.
+const magicLinkTTL = 15 * time.Minute
+
+type MagicLinkInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// magicBinding ties a sign-in link to the address it was mailed to, so a
+// link sent before an email change stops working after it.
+func magicBinding(user *models.User) string {
+	return user.ID.Hex() + "|" + user.Email
+}
+
+// RequestMagicLink mails a single-use sign-in link. The response is the same
+// whether or not the address is registered.
+func RequestMagicLink(c *gin.Context) {
+	start := time.Now()
+
+	var input MagicLinkInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/login/magic", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Counted for every address, registered or not, so the limit reveals
+	// nothing about which ones exist.
+	allowed, retryAfter, err := ratelimit.AllowMagicLink(input.Email)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/login/magic", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send sign-in link"})
+		return
+	}
+	if !allowed {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		metrics.HttpRequests.WithLabelValues("/login/magic", "429").Inc()
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":      "Too many sign-in links requested for this address. Try again later.",
+			"retryAfter": seconds,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err = userCollection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		metrics.HttpRequests.WithLabelValues("/login/magic", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err == nil {
+		token, err := tokens.IssueOneTime(tokens.PurposeMagicLogin, magicBinding(&user), magicLinkTTL)
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/login/magic", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send sign-in link"})
+			return
+		}
+
+		sendMail(mailer.Message{
+			To:      user.Email,
+			Subject: "Your Rysto sign-in link",
+			Body: "Use this link to sign in to Rysto:\n\n" +
+				link("/login/magic", token) + "\n\n" +
+				"The link works once and expires in 15 minutes. If you did not ask for it, ignore this email; " +
+				"nobody can sign in without it.",
+		})
+		metrics.MagicLinksSent.Inc()
+	}
+
+	metrics.HttpRequests.WithLabelValues("/login/magic", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/login/magic").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists, a sign-in link has been sent"})
+}
+
+// MagicLogin exchanges a sign-in link for a session, like Login, or for a
+// two-factor challenge when the account has two-factor authentication
+// enabled. The link proves control of the address, so it also verifies it.
+// Mail scanners follow the links in incoming mail, so the app page the link
+// opens should only call this once the user confirms.
+func MagicLogin(c *gin.Context) {
+	start := time.Now()
+
+	binding, err := tokens.ConsumeOneTime(tokens.PurposeMagicLogin, c.Param("token"))
+	if err == tokens.ErrInvalidToken {
+		metrics.HttpRequests.WithLabelValues("/login/magic/token", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired sign-in link"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/login/magic/token", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userID, _, _ := strings.Cut(binding, "|")
+	var user models.User
+	if err := userCollection.FindOne(ctx, byID(userID)).Decode(&user); err != nil || magicBinding(&user) != binding {
+		metrics.HttpRequests.WithLabelValues("/login/magic/token", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired sign-in link"})
+		return
+	}
+
+	if refuseRestricted(c, "/login/magic/token", &user) {
+		return
+	}
+
+	if !user.Verified {
+		now := time.Now()
+		if _, err := userCollection.UpdateOne(ctx,
+			bson.M{"_id": user.ID},
+			bson.M{"$set": bson.M{"verified": true, "verifiedAt": now}},
+		); err != nil {
+			log.Printf("MagicLogin: failed to mark %s verified: %v", userID, err)
+		} else {
+			user.Verified, user.VerifiedAt = true, &now
+			metrics.EmailsVerified.Inc()
+		}
+	}
+
+	// The link stands in for the password only.
+	if user.TOTPEnabled {
+		challenge, err := tokens.IssueChallenge(userID)
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/login/magic/token", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create login challenge"})
+			return
+		}
+
+		metrics.HttpRequests.WithLabelValues("/login/magic/token", "200").Inc()
+		metrics.HttpRequestDuration.WithLabelValues("/login/magic/token").Observe(time.Since(start).Seconds())
+		c.JSON(http.StatusOK, TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresIn:         int(tokens.ChallengeTTL.Seconds()),
+			Message:           "Two-factor code required",
+		})
+		return
+	}
+
+	resp, err := startSession(c, &user, "magic_link")
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/login/magic/token", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	loginSucceeded(user.Email)
+	metrics.SuccessfulLogins.Inc()
+	metrics.HttpRequests.WithLabelValues("/login/magic/token", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/login/magic/token").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, resp)
+}
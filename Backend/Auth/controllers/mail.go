@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"authService.com/auth/mailer"
+)
+
+var mail mailer.Mailer
+
+// appURL is the origin of the web app, not of this service. Links in emails
+// and the redirects that finish OAuth flows land on pages of the app, which
+// pass the token on to Auth:
+//
+//	/verify?token=                  POST /verify
+//	/password/reset?token=          POST /password/reset
+//	/login/unlock?token=            POST /login/unlock
+//	/email/confirm?token=           POST /email/confirm
+//	/login/magic?token=             GET /login/magic/:token
+//	/account/delete/confirm?token=  DELETE /account with the token
+//	/oauth/consent?token=           GET and POST /oauth/requests/:id
+//	/oauth/complete?token=          POST /oauth/complete
+//
+// Without APP_URL the links are relative.
+var appURL string
+
+// SetMailer injects the transport used for every Auth email.
+func SetMailer(m mailer.Mailer) {
+	mail = m
+}
+
+// SetAppURL sets the origin of the web app that links in emails point to.
+func SetAppURL(u string) {
+	appURL = strings.TrimRight(u, "/")
+}
+
+// link builds a link to the app page at path carrying token as a query
+// parameter.
+func link(path, token string) string {
+	return appURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendMail delivers msg in the background so slow mail relays never hold up
+// a request; failures are logged.
+func sendMail(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := mail.Send(ctx, msg); err != nil {
+			log.Printf("Mailer: failed to send %q: %v", msg.Subject, err)
+		}
+	}()
+}
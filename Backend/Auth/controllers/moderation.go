@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"authService.com/auth/audit"
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+	"authService.com/auth/sessions"
+
+	"rysto/pkg/redis"
+	"rysto/pkg/userstatus"
+)
+
+type UserStatusInput struct {
+	Status string    `json:"status" binding:"required,oneof=suspended banned"`
+	Reason string    `json:"reason" binding:"required,max=500"`
+	Until  time.Time `json:"until"` // required for suspensions, not allowed for bans
+}
+
+// SetUserStatus suspends an account until a given time or bans it for good.
+// Its sessions end at once, and every service rejects its remaining tokens
+// and API keys while the restriction lasts.
+func SetUserStatus(c *gin.Context) {
+	start := time.Now()
+
+	var input UserStatusInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/admin/status/set", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Status == userstatus.Suspended && !input.Until.After(time.Now()) {
+		metrics.HttpRequests.WithLabelValues("/admin/status/set", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A suspension needs an until date in the future"})
+		return
+	}
+	if input.Status == userstatus.Banned && !input.Until.IsZero() {
+		metrics.HttpRequests.WithLabelValues("/admin/status/set", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bans do not expire; suspend the account instead"})
+		return
+	}
+	if c.Param("id") == c.GetString("userId") {
+		metrics.HttpRequests.WithLabelValues("/admin/status/set", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admins cannot suspend or ban themselves"})
+		return
+	}
+
+	update := bson.M{"$set": bson.M{"status": input.Status, "statusReason": input.Reason}}
+	if input.Status == userstatus.Suspended {
+		update["$set"].(bson.M)["statusUntil"] = input.Until.UTC()
+	} else {
+		update["$unset"] = bson.M{"statusUntil": ""}
+	}
+	user, ok := updateUser(c, "/admin/status/set", update)
+	if !ok {
+		return
+	}
+	userID := user.ID.Hex()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Published before the sessions end, so the account's API keys stop
+	// working even if ending them fails.
+	status := &userstatus.Status{State: input.Status, Reason: input.Reason, Until: input.Until.UTC()}
+	if err := userstatus.Publish(ctx, redis.Client, userID, *status); err != nil {
+		metrics.HttpRequests.WithLabelValues("/admin/status/set", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Status saved but failed to publish it to the services"})
+		return
+	}
+	revoked, err := sessions.RevokeAll(userID)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/admin/status/set", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Status saved but failed to end the user's sessions"})
+		return
+	}
+
+	event := audit.Event{
+		Type:    audit.TypeSuspended,
+		UserID:  userID,
+		Details: map[string]string{"reason": input.Reason, "sessionsRevoked": strconv.Itoa(revoked)},
+	}
+	action := "suspend"
+	if input.Status == userstatus.Banned {
+		event.Type, action = audit.TypeBanned, "ban"
+	} else {
+		event.Details["until"] = status.Until.Format(time.RFC3339)
+	}
+	recordEvent(c, event)
+
+	metrics.AccountRestrictions.WithLabelValues(action).Inc()
+	metrics.HttpRequests.WithLabelValues("/admin/status/set", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/admin/status/set").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"id": userID, "handle": user.Handle, "status": status, "sessionsRevoked": revoked})
+}
+
+// ClearUserStatus lifts a suspension or ban. The user has to sign in again;
+// API keys work again right away.
+func ClearUserStatus(c *gin.Context) {
+	start := time.Now()
+
+	user, ok := updateUser(c, "/admin/status/clear",
+		bson.M{"$unset": bson.M{"status": "", "statusReason": "", "statusUntil": ""}})
+	if !ok {
+		return
+	}
+	userID := user.ID.Hex()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := userstatus.Clear(ctx, redis.Client, userID); err != nil {
+		metrics.HttpRequests.WithLabelValues("/admin/status/clear", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Status cleared but failed to publish it to the services"})
+		return
+	}
+
+	recordEvent(c, audit.Event{Type: audit.TypeReinstated, UserID: userID})
+	metrics.AccountRestrictions.WithLabelValues("reinstate").Inc()
+	metrics.HttpRequests.WithLabelValues("/admin/status/clear", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/admin/status/clear").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"id": userID, "handle": user.Handle, "status": nil})
+}
+
+// PublishUserStatuses writes every restriction in force to Redis, so the
+// services keep rejecting restricted accounts after Redis lost its data.
+func PublishUserStatuses(ctx context.Context) (int, error) {
+	users, err := models.RestrictedUsers(ctx, userCollection)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	published := 0
+	for i := range users {
+		status := users[i].Restriction(now)
+		if status == nil {
+			continue
+		}
+		if err := userstatus.Publish(ctx, redis.Client, users[i].ID.Hex(), *status); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// refuseRestricted turns away a sign-in to a suspended or banned account,
+// saying why and until when. It returns false for accounts in good standing.
+func refuseRestricted(c *gin.Context, path string, user *models.User) bool {
+	status := user.Restriction(time.Now())
+	if status == nil {
+		return false
+	}
+
+	recordEvent(c, audit.Event{
+		Type:    audit.TypeLoginFailed,
+		UserID:  user.ID.Hex(),
+		Email:   user.Email,
+		Details: map[string]string{"reason": status.State},
+	})
+	metrics.FailedLogins.Inc()
+	metrics.HttpRequests.WithLabelValues(path, "403").Inc()
+	c.JSON(http.StatusForbidden, restrictionBody(status))
+	return true
+}
+
+// restrictionBody is the error response for a restricted account.
+func restrictionBody(status *userstatus.Status) gin.H {
+	body := gin.H{"status": status.State, "reason": status.Reason}
+	if status.State == userstatus.Banned {
+		body["error"] = "This account has been banned"
+	} else {
+		body["error"] = "This account is suspended until " + status.Until.UTC().Format(time.RFC1123)
+		body["until"] = status.Until
+	}
+	return body
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+	"authService.com/auth/sessions"
+	"authService.com/auth/utils"
+)
+
+const (
+	maxClientNameLength   = 64
+	maxClientRedirectURIs = 10
+	maxClientsPerUser     = 10
+)
+
+var clientCollection *mongo.Collection
+
+// SetClientCollection injects the collection of registered OAuth clients.
+func SetClientCollection(collection *mongo.Collection) {
+	clientCollection = collection
+}
+
+type RegisterClientInput struct {
+	Name         string   `json:"name" binding:"required"`
+	RedirectURIs []string `json:"redirectUris" binding:"required,min=1"`
+	Scopes       []string `json:"scopes" binding:"required,min=1"`
+	Confidential bool     `json:"confidential"` // false for apps that cannot keep a secret
+}
+
+// RegisterClient registers a third-party app owned by the logged-in user.
+// The client secret of a confidential client is shown once.
+func RegisterClient(c *gin.Context) {
+	start := time.Now()
+
+	var input RegisterClientInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/clients/create", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxClientNameLength {
+		metrics.HttpRequests.WithLabelValues("/oauth/clients/create", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be 1-64 characters"})
+		return
+	}
+	if len(input.RedirectURIs) > maxClientRedirectURIs {
+		metrics.HttpRequests.WithLabelValues("/oauth/clients/create", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At most 10 redirect URIs"})
+		return
+	}
+	for _, uri := range input.RedirectURIs {
+		if !models.ValidRedirectURI(uri) {
+			metrics.HttpRequests.WithLabelValues("/oauth/clients/create", "400").Inc()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Redirect URIs must be https (or http on localhost) without a fragment", "redirectUri": uri})
+			return
+		}
+	}
+	scopes, ok := normalizeScopes(input.Scopes)
+	if !ok {
+		metrics.HttpRequests.WithLabelValues("/oauth/clients/create", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope", "validScopes": validScopes()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ownerID := c.GetString("userId")
+	count, err := clientCollection.CountDocuments(ctx, bson.M{"ownerId": ownerID})
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/clients/create", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if count >= maxClientsPerUser {
+		metrics.HttpRequests.WithLabelValues("/oauth/clients/create", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Too many apps; delete one first"})
+		return
+	}
+
+	clientID, err := utils.GenerateOpaqueToken(16)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/clients/create", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register app"})
+		return
+	}
+	client := models.Client{
+		ClientID:     clientID,
+		Name:         name,
+		RedirectURIs: input.RedirectURIs,
+		Scopes:       scopes,
+		Confidential: input.Confidential,
+		OwnerID:      ownerID,
+		CreatedAt:    time.Now(),
+	}
+
+	var secret string
+	if client.Confidential {
+		if secret, err = utils.GenerateOpaqueToken(32); err != nil {
+			metrics.HttpRequests.WithLabelValues("/oauth/clients/create", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register app"})
+			return
+		}
+		client.SecretHash = utils.HashToken(secret)
+	}
+
+	if _, err := clientCollection.InsertOne(ctx, client); err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/clients/create", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register app"})
+		return
+	}
+
+	resp := gin.H{"client": client}
+	if secret != "" {
+		resp["clientSecret"] = secret
+		resp["message"] = "Store the client secret now; it will not be shown again"
+	}
+
+	metrics.HttpRequests.WithLabelValues("/oauth/clients/create", "201").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/oauth/clients/create").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListClients returns the apps the logged-in user registered.
+func ListClients(c *gin.Context) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := clientCollection.Find(ctx, bson.M{"ownerId": c.GetString("userId")})
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/clients", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load apps"})
+		return
+	}
+	clients := []models.Client{}
+	if err := cursor.All(ctx, &clients); err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/clients", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load apps"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/oauth/clients", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/oauth/clients").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, clients)
+}
+
+// DeleteClient removes one of the logged-in user's apps and signs it out of
+// every account that authorized it.
+func DeleteClient(c *gin.Context) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	clientID := c.Param("clientId")
+	res, err := clientCollection.DeleteOne(ctx, bson.M{"clientId": clientID, "ownerId": c.GetString("userId")})
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/clients/delete", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete app"})
+		return
+	}
+	if res.DeletedCount == 0 {
+		metrics.HttpRequests.WithLabelValues("/oauth/clients/delete", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "App not found"})
+		return
+	}
+
+	revoked, err := sessions.RevokeClient(clientID)
+	if err != nil {
+		log.Printf("DeleteClient: failed to revoke sessions of %s: %v", clientID, err)
+	}
+
+	metrics.HttpRequests.WithLabelValues("/oauth/clients/delete", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/oauth/clients/delete").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "App deleted", "sessionsRevoked": revoked})
+}
+
+// deleteOwnedClients removes every app a user registered, for account
+// deletion.
+func deleteOwnedClients(ctx context.Context, ownerID string) error {
+	cursor, err := clientCollection.Find(ctx, bson.M{"ownerId": ownerID})
+	if err != nil {
+		return err
+	}
+	var clients []models.Client
+	if err := cursor.All(ctx, &clients); err != nil {
+		return err
+	}
+	for _, client := range clients {
+		if _, err := sessions.RevokeClient(client.ClientID); err != nil {
+			return err
+		}
+	}
+	_, err = clientCollection.DeleteMany(ctx, bson.M{"ownerId": ownerID})
+	return err
+}
@@ -0,0 +1,578 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"authService.com/auth/audit"
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+	"authService.com/auth/sessions"
+	"authService.com/auth/tokens"
+	"authService.com/auth/utils"
+
+	"rysto/pkg/redis"
+)
+
+const (
+	// authRequestTTL is how long the user has to decide on the consent screen.
+	authRequestTTL = 10 * time.Minute
+	// authCodeTTL is how long a client has to redeem an authorization code.
+	authCodeTTL = time.Minute
+)
+
+// authRequest is a pending authorization waiting for the user's consent.
+// RedirectGiven records whether the app named RedirectURI itself or left it
+// to default to its only registered one; RFC 6749 4.1.3 requires the token
+// request to repeat it only in the first case.
+type authRequest struct {
+	ClientID      string `json:"clientId"`
+	RedirectURI   string `json:"redirectUri"`
+	RedirectGiven bool   `json:"redirectGiven,omitempty"`
+	Scope         string `json:"scope"`
+	State         string `json:"state"`
+	Challenge     string `json:"challenge"`
+}
+
+// authCode is what an authorization code stands for.
+type authCode struct {
+	authRequest
+	UserID string `json:"user"`
+}
+
+type AuthorizationDecisionInput struct {
+	Approve *bool `json:"approve" binding:"required"`
+}
+
+// tokenResponse is the RFC 6749 access token response.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// Authorize validates an OAuth authorization request from a third-party app
+// and sends the browser to the app's consent screen.
+func Authorize(c *gin.Context) {
+	start := time.Now()
+	q := c.Request.URL.Query()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Until the client and redirect URI check out, errors must not redirect:
+	// that would make Rysto an open redirector.
+	var client models.Client
+	if err := clientCollection.FindOne(ctx, bson.M{"clientId": q.Get("client_id")}).Decode(&client); err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/authorize", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown client"})
+		return
+	}
+	redirectURI := q.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !client.AllowsRedirect(redirectURI) {
+		metrics.HttpRequests.WithLabelValues("/oauth/authorize", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "redirect_uri is not registered for this client"})
+		return
+	}
+
+	state := q.Get("state")
+	fail := func(code, description string) {
+		metrics.HttpRequests.WithLabelValues("/oauth/authorize", "302").Inc()
+		c.Redirect(http.StatusFound, withParams(redirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+			"state":             {state},
+		}))
+	}
+
+	if q.Get("response_type") != "code" {
+		fail("unsupported_response_type", "Only the authorization code flow is supported")
+		return
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		fail("invalid_request", "PKCE with code_challenge_method S256 is required")
+		return
+	}
+
+	requested := strings.Fields(q.Get("scope"))
+	if len(requested) == 0 {
+		requested = client.Scopes
+	}
+	scopes, ok := normalizeScopes(requested)
+	for _, s := range scopes {
+		ok = ok && client.AllowsScope(s)
+	}
+	if !ok {
+		fail("invalid_scope", "The app is not registered for the requested scope")
+		return
+	}
+
+	data, _ := json.Marshal(authRequest{
+		ClientID:      client.ClientID,
+		RedirectURI:   redirectURI,
+		RedirectGiven: q.Get("redirect_uri") != "",
+		Scope:         strings.Join(scopes, " "),
+		State:         state,
+		Challenge:     q.Get("code_challenge"),
+	})
+	requestID, err := tokens.IssueOneTime(tokens.PurposeAuthRequest, string(data), authRequestTTL)
+	if err != nil {
+		fail("server_error", "Failed to start authorization")
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/oauth/authorize", "302").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/oauth/authorize").Observe(time.Since(start).Seconds())
+	c.Redirect(http.StatusFound, link("/oauth/consent", requestID))
+}
+
+// GetAuthorizationRequest describes a pending authorization for the consent
+// screen: which app asks for which scopes.
+func GetAuthorizationRequest(c *gin.Context) {
+	start := time.Now()
+
+	value, err := tokens.PeekOneTime(tokens.PurposeAuthRequest, c.Param("id"))
+	if err == tokens.ErrInvalidToken {
+		metrics.HttpRequests.WithLabelValues("/oauth/requests", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Authorization request not found or expired"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/requests", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load authorization request"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, client, ok := loadAuthRequest(ctx, value)
+	if !ok {
+		metrics.HttpRequests.WithLabelValues("/oauth/requests", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Authorization request not found or expired"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/oauth/requests", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/oauth/requests").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{
+		"clientId":    client.ClientID,
+		"clientName":  client.Name,
+		"scopes":      strings.Fields(req.Scope),
+		"redirectUri": req.RedirectURI,
+	})
+}
+
+// DecideAuthorization records the logged-in user's consent decision and
+// returns where to send the browser: back to the app with a code, or with
+// access_denied.
+func DecideAuthorization(c *gin.Context) {
+	start := time.Now()
+
+	var input AuthorizationDecisionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/requests/decide", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	value, err := tokens.ConsumeOneTime(tokens.PurposeAuthRequest, c.Param("id"))
+	if err == tokens.ErrInvalidToken {
+		metrics.HttpRequests.WithLabelValues("/oauth/requests/decide", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Authorization request not found or expired"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/requests/decide", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load authorization request"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, _, ok := loadAuthRequest(ctx, value)
+	if !ok {
+		metrics.HttpRequests.WithLabelValues("/oauth/requests/decide", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Authorization request not found or expired"})
+		return
+	}
+
+	if !*input.Approve {
+		metrics.OAuthAuthorizations.WithLabelValues("denied").Inc()
+		metrics.HttpRequests.WithLabelValues("/oauth/requests/decide", "200").Inc()
+		c.JSON(http.StatusOK, gin.H{"redirectUrl": withParams(req.RedirectURI, url.Values{
+			"error": {"access_denied"},
+			"state": {req.State},
+		})})
+		return
+	}
+
+	data, _ := json.Marshal(authCode{authRequest: *req, UserID: c.GetString("userId")})
+	code, err := tokens.IssueOneTime(tokens.PurposeAuthCode, string(data), authCodeTTL)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/requests/decide", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue authorization code"})
+		return
+	}
+
+	metrics.OAuthAuthorizations.WithLabelValues("approved").Inc()
+	metrics.HttpRequests.WithLabelValues("/oauth/requests/decide", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/oauth/requests/decide").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"redirectUrl": withParams(req.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {req.State},
+	})})
+}
+
+// loadAuthRequest decodes a stored authorization request and loads its
+// client, which may have been deleted in the meantime.
+func loadAuthRequest(ctx context.Context, value string) (*authRequest, *models.Client, bool) {
+	var req authRequest
+	if err := json.Unmarshal([]byte(value), &req); err != nil {
+		return nil, nil, false
+	}
+	var client models.Client
+	if err := clientCollection.FindOne(ctx, bson.M{"clientId": req.ClientID}).Decode(&client); err != nil {
+		return nil, nil, false
+	}
+	return &req, &client, true
+}
+
+// Token is the OAuth token endpoint. It redeems authorization codes and
+// rotates refresh tokens for authenticated clients.
+func Token(c *gin.Context) {
+	start := time.Now()
+	c.Header("Cache-Control", "no-store")
+
+	client, ok := authenticateClient(c, "/oauth/token")
+	if !ok {
+		return
+	}
+
+	var resp *tokenResponse
+	grantType := c.PostForm("grant_type")
+	switch grantType {
+	case "authorization_code":
+		resp, ok = tokenFromCode(c, client)
+	case "refresh_token":
+		resp, ok = tokenFromRefresh(c, client)
+	default:
+		oauthError(c, "/oauth/token", http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+	if !ok {
+		return
+	}
+
+	metrics.OAuthTokensIssued.WithLabelValues(grantType).Inc()
+	metrics.HttpRequests.WithLabelValues("/oauth/token", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/oauth/token").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, resp)
+}
+
+func tokenFromCode(c *gin.Context, client *models.Client) (*tokenResponse, bool) {
+	value, err := tokens.ConsumeOneTime(tokens.PurposeAuthCode, c.PostForm("code"))
+	if err != nil {
+		oauthError(c, "/oauth/token", http.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code")
+		return nil, false
+	}
+	var code authCode
+	if err := json.Unmarshal([]byte(value), &code); err != nil {
+		oauthError(c, "/oauth/token", http.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code")
+		return nil, false
+	}
+
+	// A redirect_uri sent here must match even when the app left it out at
+	// /authorize.
+	redirectURI, sent := c.GetPostForm("redirect_uri")
+	redirectMismatch := (code.RedirectGiven || sent) && code.RedirectURI != redirectURI
+
+	verifier := c.PostForm("code_verifier")
+	if code.ClientID != client.ClientID || redirectMismatch ||
+		len(verifier) < 43 || len(verifier) > 128 ||
+		subtle.ConstantTimeCompare([]byte(utils.PKCEChallenge(verifier)), []byte(code.Challenge)) != 1 {
+		oauthError(c, "/oauth/token", http.StatusBadRequest, "invalid_grant", "Authorization code does not match the request")
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, byID(code.UserID)).Decode(&user); err != nil {
+		oauthError(c, "/oauth/token", http.StatusBadRequest, "invalid_grant", "Account no longer exists")
+		return nil, false
+	}
+	if user.Restriction(time.Now()) != nil {
+		oauthError(c, "/oauth/token", http.StatusBadRequest, "invalid_grant", "Account is suspended or banned")
+		return nil, false
+	}
+
+	sessionID, err := sessions.CreateForClient(code.UserID, client.ClientID, code.Scope, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		oauthError(c, "/oauth/token", http.StatusInternalServerError, "server_error", "")
+		return nil, false
+	}
+	refreshToken, err := tokens.Issue(sessionID, code.UserID)
+	if err != nil {
+		_ = sessions.Revoke(code.UserID, sessionID)
+		oauthError(c, "/oauth/token", http.StatusInternalServerError, "server_error", "")
+		return nil, false
+	}
+	accessToken, err := issueClientToken(&user, sessionID, client.ClientID, code.Scope)
+	if err != nil {
+		_ = sessions.Revoke(code.UserID, sessionID)
+		oauthError(c, "/oauth/token", http.StatusInternalServerError, "server_error", "")
+		return nil, false
+	}
+
+	return &tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        code.Scope,
+	}, true
+}
+
+func tokenFromRefresh(c *gin.Context, client *models.Client) (*tokenResponse, bool) {
+	userID, family, refreshToken, err := tokens.Rotate(c.PostForm("refresh_token"), client.ClientID)
+	switch {
+	case err == tokens.ErrRefreshTokenReused:
+		log.Printf("Token: refresh token reuse by client %s for user %s, session revoked", client.ClientID, userID)
+		recordEvent(c, audit.Event{
+			Type:      audit.TypeSessionRevoked,
+			UserID:    userID,
+			SessionID: family,
+			Details:   map[string]string{"reason": "refresh_token_reuse", "client": client.ClientID},
+		})
+		metrics.RefreshTokenReuse.Inc()
+		oauthError(c, "/oauth/token", http.StatusBadRequest, "invalid_grant", "Refresh token reuse detected, authorization revoked")
+		return nil, false
+	case err == tokens.ErrInvalidRefreshToken:
+		oauthError(c, "/oauth/token", http.StatusBadRequest, "invalid_grant", "Invalid or expired refresh token")
+		return nil, false
+	case err != nil:
+		oauthError(c, "/oauth/token", http.StatusInternalServerError, "server_error", "")
+		return nil, false
+	}
+
+	_, scope, err := sessions.ClientOf(family)
+	if err != nil {
+		oauthError(c, "/oauth/token", http.StatusBadRequest, "invalid_grant", "Invalid or expired refresh token")
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, byID(userID)).Decode(&user); err != nil {
+		_ = sessions.Revoke(userID, family)
+		oauthError(c, "/oauth/token", http.StatusBadRequest, "invalid_grant", "Account no longer exists")
+		return nil, false
+	}
+	if user.Restriction(time.Now()) != nil {
+		_ = sessions.Revoke(userID, family)
+		oauthError(c, "/oauth/token", http.StatusBadRequest, "invalid_grant", "Account is suspended or banned")
+		return nil, false
+	}
+
+	accessToken, err := issueClientToken(&user, family, client.ClientID, scope)
+	if err != nil {
+		oauthError(c, "/oauth/token", http.StatusInternalServerError, "server_error", "")
+		return nil, false
+	}
+
+	return &tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        scope,
+	}, true
+}
+
+// issueClientToken signs an access token for an OAuth client's session and
+// stores it in Redis, like issueAccessToken does for Rysto's own clients.
+func issueClientToken(user *models.User, sessionID, clientID, scope string) (string, error) {
+	token, err := utils.GenerateClientToken(user, sessionID, clientID, scope)
+	if err != nil {
+		return "", err
+	}
+	if err := sessions.BindAccessToken(sessionID, user.ID.Hex(), token, utils.AccessTokenTTL); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Introspect reports whether an access token issued to the calling client is
+// active (RFC 7662). Tokens of other clients are reported as inactive.
+func Introspect(c *gin.Context) {
+	start := time.Now()
+	c.Header("Cache-Control", "no-store")
+
+	client, ok := authenticateClient(c, "/oauth/introspect")
+	if !ok {
+		return
+	}
+
+	inactive := gin.H{"active": false}
+	raw := c.PostForm("token")
+
+	claims, err := utils.Validator().Validate(raw)
+	if err != nil || claims.ClientID != client.ClientID {
+		metrics.HttpRequests.WithLabelValues("/oauth/introspect", "200").Inc()
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+	owner, err := redis.Client.Get(redis.Ctx, raw).Result()
+	if err != nil || owner != claims.Subject {
+		metrics.HttpRequests.WithLabelValues("/oauth/introspect", "200").Inc()
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/oauth/introspect", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/oauth/introspect").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{
+		"active":     true,
+		"scope":      claims.Scope,
+		"client_id":  claims.ClientID,
+		"sub":        claims.Subject,
+		"username":   claims.Handle,
+		"token_type": "Bearer",
+		"iss":        claims.Issuer,
+		"exp":        claims.ExpiresAt.Unix(),
+		"iat":        claims.IssuedAt.Unix(),
+	})
+}
+
+// ListAuthorizedApps returns the third-party apps the logged-in user has
+// authorized. Each one is a session and is revoked like one.
+func ListAuthorizedApps(c *gin.Context) {
+	start := time.Now()
+
+	list, err := sessions.List(c.GetString("userId"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/apps", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load apps"})
+		return
+	}
+
+	var clientIDs []string
+	for _, s := range list {
+		if s.Client != "" {
+			clientIDs = append(clientIDs, s.Client)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	names := map[string]string{}
+	if len(clientIDs) > 0 {
+		cursor, err := clientCollection.Find(ctx, bson.M{"clientId": bson.M{"$in": clientIDs}})
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/oauth/apps", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load apps"})
+			return
+		}
+		var clients []models.Client
+		if err := cursor.All(ctx, &clients); err != nil {
+			metrics.HttpRequests.WithLabelValues("/oauth/apps", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load apps"})
+			return
+		}
+		for _, client := range clients {
+			names[client.ClientID] = client.Name
+		}
+	}
+
+	apps := []gin.H{}
+	for _, s := range list {
+		if s.Client == "" {
+			continue
+		}
+		apps = append(apps, gin.H{
+			"id":         s.ID,
+			"clientId":   s.Client,
+			"clientName": names[s.Client],
+			"scopes":     strings.Fields(s.Scope),
+			"createdAt":  s.CreatedAt,
+			"lastSeen":   s.LastSeen,
+		})
+	}
+
+	metrics.HttpRequests.WithLabelValues("/oauth/apps", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/oauth/apps").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, apps)
+}
+
+// authenticateClient identifies the calling client from HTTP Basic auth or
+// the client_id and client_secret form fields. Confidential clients must
+// present their secret. On failure it has already written the response.
+func authenticateClient(c *gin.Context, path string) (*models.Client, bool) {
+	id, secret, basic := c.Request.BasicAuth()
+	if !basic {
+		id, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var client models.Client
+	err := clientCollection.FindOne(ctx, bson.M{"clientId": id}).Decode(&client)
+	ok := err == nil && id != ""
+	if ok && client.Confidential {
+		ok = subtle.ConstantTimeCompare([]byte(utils.HashToken(secret)), []byte(client.SecretHash)) == 1
+	}
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="rysto"`)
+		oauthError(c, path, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return nil, false
+	}
+	return &client, true
+}
+
+// oauthError writes an RFC 6749 error response.
+func oauthError(c *gin.Context, path string, status int, code, description string) {
+	metrics.HttpRequests.WithLabelValues(path, strconv.Itoa(status)).Inc()
+	body := gin.H{"error": code}
+	if description != "" {
+		body["error_description"] = description
+	}
+	c.JSON(status, body)
+}
+
+// withParams appends params to the query of uri.
+func withParams(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	q := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			q[k] = v
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
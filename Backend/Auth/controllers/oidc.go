@@ -0,0 +1,382 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"authService.com/auth/mailer"
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+	"authService.com/auth/oidc"
+	"authService.com/auth/registration"
+	"authService.com/auth/tokens"
+
+	"rysto/pkg/token"
+)
+
+// oidcCompletionTTL is how long the app has to redeem the code it receives
+// after a provider sign-in.
+const oidcCompletionTTL = time.Minute
+
+var (
+	errIdentityUnverified = errors.New("provider did not verify the email address")
+	errAccountUnverified  = errors.New("local account with this email is not verified")
+	errInviteRequired     = errors.New("registration requires an invite code")
+)
+
+type CompleteOIDCLoginInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ListProviders returns the identity providers users can sign in with.
+func ListProviders(c *gin.Context) {
+	list := []gin.H{}
+	for _, p := range oidc.List() {
+		list = append(list, gin.H{"id": p.ID, "name": p.Name, "loginUrl": "/oauth/" + p.ID + "/login"})
+	}
+	metrics.HttpRequests.WithLabelValues("/oauth/providers", "200").Inc()
+	c.JSON(http.StatusOK, list)
+}
+
+// OIDCLogin redirects the browser to the provider's sign-in page.
+func OIDCLogin(c *gin.Context) {
+	start := time.Now()
+
+	p, err := oidc.Get(c.Param("provider"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/login", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	authURL, err := p.Begin(ctx)
+	if err != nil {
+		log.Printf("OIDCLogin: %s: %v", p.ID, err)
+		metrics.HttpRequests.WithLabelValues("/oauth/login", "502").Inc()
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/oauth/login", "302").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/oauth/login").Observe(time.Since(start).Seconds())
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback finishes a provider sign-in, finds, links or creates the
+// account and hands the app a short-lived code to redeem at /oauth/complete.
+func OIDCCallback(c *gin.Context) {
+	start := time.Now()
+
+	p, err := oidc.Get(c.Param("provider"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/callback", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+	if e := c.Query("error"); e != "" || c.Query("code") == "" {
+		metrics.OIDCLogins.WithLabelValues(p.ID, "denied").Inc()
+		metrics.HttpRequests.WithLabelValues("/oauth/callback", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in was cancelled or denied", "providerError": e})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	identity, err := p.Finish(ctx, c.Query("state"), c.Query("code"))
+	if err == oidc.ErrInvalidState {
+		metrics.HttpRequests.WithLabelValues("/oauth/callback", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in expired, please start again"})
+		return
+	}
+	if err != nil {
+		log.Printf("OIDCCallback: %s: %v", p.ID, err)
+		metrics.OIDCLogins.WithLabelValues(p.ID, "failed").Inc()
+		metrics.HttpRequests.WithLabelValues("/oauth/callback", "502").Inc()
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Could not verify the sign-in with the identity provider"})
+		return
+	}
+
+	user, outcome, err := userForIdentity(ctx, identity)
+	switch {
+	case err == errIdentityUnverified:
+		metrics.HttpRequests.WithLabelValues("/oauth/callback", "403").Inc()
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your email address is not verified with " + p.Name})
+		return
+	case err == errInviteRequired:
+		metrics.HttpRequests.WithLabelValues("/oauth/callback", "403").Inc()
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is by invitation. Register with your invite code first, then sign in with " + p.Name + "."})
+		return
+	case err == errAccountUnverified:
+		metrics.HttpRequests.WithLabelValues("/oauth/callback", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this email exists but is not verified. Verify it or sign in with your password first."})
+		return
+	case err != nil:
+		metrics.HttpRequests.WithLabelValues("/oauth/callback", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+
+	if outcome == "linked" {
+		sendMail(mailer.Message{
+			To:      user.Email,
+			Subject: p.Name + " sign-in linked to your Rysto account",
+			Body: "You can now sign in to Rysto with " + p.Name + ".\n\n" +
+				"If this was not you, change your password and unlink " + p.Name + " from your account.",
+		})
+	}
+
+	code, err := tokens.IssueOneTime(tokens.PurposeOIDCLogin, user.ID.Hex(), oidcCompletionTTL)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/callback", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+
+	metrics.OIDCLogins.WithLabelValues(p.ID, outcome).Inc()
+	metrics.HttpRequests.WithLabelValues("/oauth/callback", "302").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/oauth/callback").Observe(time.Since(start).Seconds())
+	c.Redirect(http.StatusFound, link("/oauth/complete", code))
+}
+
+// CompleteOIDCLogin exchanges the code from OIDCCallback for a session, or
+// for a two-factor challenge when the account has it enabled.
+func CompleteOIDCLogin(c *gin.Context) {
+	start := time.Now()
+
+	var input CompleteOIDCLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/complete", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := tokens.ConsumeOneTime(tokens.PurposeOIDCLogin, input.Token)
+	if err == tokens.ErrInvalidToken {
+		metrics.HttpRequests.WithLabelValues("/oauth/complete", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired sign-in code"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/complete", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, byID(userID)).Decode(&user); err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/complete", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired sign-in code"})
+		return
+	}
+	if refuseRestricted(c, "/oauth/complete", &user) {
+		return
+	}
+
+	// The provider vouches for the first factor only.
+	if user.TOTPEnabled {
+		challenge, err := tokens.IssueChallenge(userID)
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/oauth/complete", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create login challenge"})
+			return
+		}
+
+		metrics.HttpRequests.WithLabelValues("/oauth/complete", "200").Inc()
+		metrics.HttpRequestDuration.WithLabelValues("/oauth/complete").Observe(time.Since(start).Seconds())
+		c.JSON(http.StatusOK, TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresIn:         int(tokens.ChallengeTTL.Seconds()),
+			Message:           "Two-factor code required",
+		})
+		return
+	}
+
+	resp, err := startSession(c, &user, "oidc")
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/oauth/complete", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	metrics.SuccessfulLogins.Inc()
+	metrics.HttpRequests.WithLabelValues("/oauth/complete", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/oauth/complete").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, resp)
+}
+
+// userForIdentity returns the account an external identity signs in to. An
+// identity seen before maps to its account; otherwise it is linked to the
+// verified account with the same email, or a new account is created. outcome
+// is "existing", "linked" or "created".
+func userForIdentity(ctx context.Context, id *oidc.Identity) (*models.User, string, error) {
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"identities": bson.M{"$elemMatch": bson.M{
+		"provider": id.Provider,
+		"subject":  id.Subject,
+	}}}).Decode(&user)
+	if err == nil {
+		return &user, "existing", nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, "", err
+	}
+
+	// Linking and creating both trust the provider's word on the address.
+	if !id.EmailVerified || id.Email == "" {
+		return nil, "", errIdentityUnverified
+	}
+
+	identity := models.Identity{
+		Provider: id.Provider,
+		Subject:  id.Subject,
+		Email:    id.Email,
+		LinkedAt: time.Now(),
+	}
+
+	err = userCollection.FindOne(ctx, bson.M{"email": id.Email}).Decode(&user)
+	if err == nil {
+		// Whoever registered an unverified account may not own the address,
+		// and linking would hand them the provider's sign-in.
+		if !user.Verified {
+			return nil, "", errAccountUnverified
+		}
+		if _, err := userCollection.UpdateOne(ctx,
+			bson.M{"_id": user.ID},
+			bson.M{"$push": bson.M{"identities": identity}},
+		); err != nil {
+			return nil, "", err
+		}
+		return &user, "linked", nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, "", err
+	}
+
+	// There is no way to pass an invite code through the provider, so
+	// invitees register first and link the provider afterwards.
+	if registration.NeedsInvite(id.Email) {
+		return nil, "", errInviteRequired
+	}
+
+	now := time.Now()
+	user = models.User{
+		Email:       id.Email,
+		Verified:    true,
+		VerifiedAt:  &now,
+		Roles:       []string{token.RoleUser},
+		DisplayName: truncateRunes(id.Name, maxDisplayNameLength),
+		CreatedAt:   now,
+		Identities:  []models.Identity{identity},
+	}
+	for attempt := 0; ; attempt++ {
+		user.Handle = models.DeriveHandle(id.Email, attempt)
+		var res *mongo.InsertOneResult
+		res, err = userCollection.InsertOne(ctx, user)
+		if err == nil {
+			user.ID = res.InsertedID.(primitive.ObjectID)
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) || models.DuplicateEmail(err) || attempt >= 10 {
+			return nil, "", err
+		}
+	}
+	return &user, "created", nil
+}
+
+// ListIdentities returns the external identities linked to the logged-in user.
+func ListIdentities(c *gin.Context) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, currentUser(c)).Decode(&user); err != nil {
+		metrics.HttpRequests.WithLabelValues("/identities", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	identities := user.Identities
+	if identities == nil {
+		identities = []models.Identity{}
+	}
+
+	metrics.HttpRequests.WithLabelValues("/identities", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/identities").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"identities": identities, "hasPassword": user.Password != ""})
+}
+
+// UnlinkIdentity removes a provider sign-in from the logged-in user, as long
+// as the account keeps another way to sign in.
+func UnlinkIdentity(c *gin.Context) {
+	start := time.Now()
+	provider := c.Param("provider")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, currentUser(c)).Decode(&user); err != nil {
+		metrics.HttpRequests.WithLabelValues("/identities/unlink", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	remaining := 0
+	found := false
+	for _, id := range user.Identities {
+		if id.Provider == provider {
+			found = true
+		} else {
+			remaining++
+		}
+	}
+	if !found {
+		metrics.HttpRequests.WithLabelValues("/identities/unlink", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Provider not linked"})
+		return
+	}
+	if user.Password == "" && remaining == 0 {
+		metrics.HttpRequests.WithLabelValues("/identities/unlink", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Set a password before unlinking your only sign-in method"})
+		return
+	}
+
+	if _, err := userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$pull": bson.M{"identities": bson.M{"provider": provider}}},
+	); err != nil {
+		metrics.HttpRequests.WithLabelValues("/identities/unlink", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink provider"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/identities/unlink", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/identities/unlink").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "Provider unlinked"})
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"authService.com/auth/audit"
+	"authService.com/auth/mailer"
+	"authService.com/auth/models"
+	"authService.com/auth/oidc"
+	"authService.com/auth/oidc/mockidp"
+	"authService.com/auth/registration"
+	"authService.com/auth/utils"
+
+	"rysto/pkg/redis"
+	"rysto/pkg/token"
+)
+
+// discardMailer drops every message.
+type discardMailer struct{}
+
+func (discardMailer) Send(context.Context, mailer.Message) error { return nil }
+
+// oidcTest runs the provider sign-in against a mock provider, with Redis in
+// memory and MongoDB answering from the responses each test queues.
+type oidcTest struct {
+	idp    *mockidp.Server
+	router *gin.Engine
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	redis.Client = goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redis.Client.Close() })
+
+	idp, err := mockidp.Start(mockidp.Config{Addr: "127.0.0.1:0", ClientID: "rysto", ClientSecret: "secret"})
+	if err != nil {
+		t.Fatalf("starting mock provider: %v", err)
+	}
+	t.Cleanup(func() { idp.Close() })
+
+	oidc.SetProviders([]*oidc.Provider{{
+		ID:           "mock",
+		Name:         "Mock",
+		Issuer:       idp.URL,
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+		RedirectURL:  "http://auth.test/oauth/mock/callback",
+	}})
+	utils.SetJWTSecret([]byte("test-secret"))
+	SetMailer(discardMailer{})
+
+	r := gin.New()
+	r.GET("/oauth/:provider/login", OIDCLogin)
+	r.GET("/oauth/:provider/callback", OIDCCallback)
+	r.POST("/oauth/complete", CompleteOIDCLogin)
+	return &oidcTest{idp: idp, router: r}
+}
+
+func (o *oidcTest) serve(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	o.router.ServeHTTP(w, req)
+	return w
+}
+
+// authorize starts a sign-in as the provider user with email, lets edit
+// change the query of the provider's authorization URL, and returns the
+// query the provider redirects back to Auth with.
+func (o *oidcTest) authorize(t *testing.T, email string, edit func(url.Values)) url.Values {
+	t.Helper()
+
+	w := o.serve(httptest.NewRequest(http.MethodGet, "/oauth/mock/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+	authURL, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	q := authURL.Query()
+	q.Set("login_hint", email)
+	if edit != nil {
+		edit(q)
+	}
+	authURL.RawQuery = q.Encode()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL.String())
+	if err != nil {
+		t.Fatalf("provider: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("provider: status %d", resp.StatusCode)
+	}
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("provider: %v", err)
+	}
+	return back.Query()
+}
+
+func (o *oidcTest) callback(q url.Values) *httptest.ResponseRecorder {
+	return o.serve(httptest.NewRequest(http.MethodGet, "/oauth/mock/callback?"+q.Encode(), nil))
+}
+
+func (o *oidcTest) complete(code string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/oauth/complete", strings.NewReader(`{"token":"`+code+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	return o.serve(req)
+}
+
+// useMock points the user and audit collections at the mock deployment.
+func useMock(mt *mtest.T) {
+	SetUserCollection(mt.Coll)
+	audit.SetCollection(mt.Coll)
+}
+
+// found answers a find with docs; none answers it with no documents.
+func found(mt *mtest.T, docs ...bson.D) bson.D {
+	ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+	return mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, docs...)
+}
+
+func none(mt *mtest.T) bson.D {
+	return found(mt)
+}
+
+func userDoc(t *testing.T, u *models.User) bson.D {
+	t.Helper()
+	data, err := bson.Marshal(u)
+	if err != nil {
+		t.Fatalf("marshal user: %v", err)
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("unmarshal user: %v", err)
+	}
+	return doc
+}
+
+func errorOf(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return body.Error
+}
+
+func TestOIDCLoginRejectsTamperedRequests(t *testing.T) {
+	o := newOIDCTest(t)
+	o.idp.AddUser(mockidp.User{Subject: "sub-1", Email: "ann@example.com", EmailVerified: true})
+
+	tests := []struct {
+		name   string
+		edit   func(url.Values)
+		back   func(url.Values)
+		status int
+	}{
+		{
+			name:   "state not issued by Auth",
+			back:   func(q url.Values) { q.Set("state", "forged") },
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "PKCE challenge replaced",
+			edit:   func(q url.Values) { q.Set("code_challenge", utils.PKCEChallenge("not-the-verifier")) },
+			status: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := o.authorize(t, "ann@example.com", tt.edit)
+			if tt.back != nil {
+				tt.back(q)
+			}
+			if w := o.callback(q); w.Code != tt.status {
+				t.Errorf("callback: status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackAccounts(t *testing.T) {
+	o := newOIDCTest(t)
+	o.idp.AddUser(mockidp.User{Subject: "sub-unverified", Email: "eve@example.com", EmailVerified: false})
+	o.idp.AddUser(mockidp.User{Subject: "sub-bob", Email: "bob@example.com", EmailVerified: true, Name: "Bob"})
+	o.idp.AddUser(mockidp.User{Subject: "sub-new", Email: "new@example.com", EmailVerified: true})
+
+	bob := &models.User{
+		ID:       primitive.NewObjectID(),
+		Email:    "bob@example.com",
+		Password: "hash",
+		Verified: true,
+		Roles:    []string{token.RoleUser},
+		Handle:   "bob",
+	}
+	unverifiedBob := *bob
+	unverifiedBob.Verified = false
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("email not verified by the provider", func(mt *mtest.T) {
+		useMock(mt)
+		mt.AddMockResponses(none(mt)) // no account has this identity yet
+
+		w := o.callback(o.authorize(mt.T, "eve@example.com", nil))
+		if w.Code != http.StatusForbidden {
+			mt.Fatalf("callback: status %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+		}
+		if !strings.Contains(errorOf(mt.T, w), "not verified") {
+			mt.Errorf("error = %q", errorOf(mt.T, w))
+		}
+	})
+
+	mt.Run("links to the verified account with the email", func(mt *mtest.T) {
+		useMock(mt)
+		mt.AddMockResponses(
+			none(mt),                      // identity lookup
+			found(mt, userDoc(mt.T, bob)), // email lookup
+			mtest.CreateSuccessResponse(), // $push of the identity
+			found(mt, userDoc(mt.T, bob)), // CompleteOIDCLogin loads the user
+			mtest.CreateSuccessResponse(), // audit event
+		)
+
+		w := o.callback(o.authorize(mt.T, "bob@example.com", nil))
+		if w.Code != http.StatusFound {
+			mt.Fatalf("callback: status %d: %s", w.Code, w.Body)
+		}
+		next, err := url.Parse(w.Header().Get("Location"))
+		if err != nil || next.Path != "/oauth/complete" {
+			mt.Fatalf("callback redirected to %q", w.Header().Get("Location"))
+		}
+
+		update := mt.GetStartedEvent()
+		for update != nil && update.CommandName != "update" {
+			update = mt.GetStartedEvent()
+		}
+		if update == nil {
+			mt.Fatal("identity was not linked")
+		}
+		cmd := update.Command.String()
+		if !strings.Contains(cmd, `"$push"`) || !strings.Contains(cmd, `"sub-bob"`) || !strings.Contains(cmd, bob.ID.Hex()) {
+			mt.Errorf("link update = %s", cmd)
+		}
+
+		w = o.complete(next.Query().Get("token"))
+		if w.Code != http.StatusOK {
+			mt.Fatalf("complete: status %d: %s", w.Code, w.Body)
+		}
+		var resp LoginResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Token == "" || resp.RefreshToken == "" {
+			mt.Fatalf("complete: response %s", w.Body)
+		}
+		claims, err := utils.Validator().Validate(resp.Token)
+		if err != nil || claims.Subject != bob.ID.Hex() {
+			mt.Errorf("access token is not bob's: %v", err)
+		}
+
+		if w := o.complete(next.Query().Get("token")); w.Code != http.StatusUnauthorized {
+			mt.Errorf("second complete: status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+
+	mt.Run("refuses to link an unverified account", func(mt *mtest.T) {
+		useMock(mt)
+		mt.AddMockResponses(none(mt), found(mt, userDoc(mt.T, &unverifiedBob)))
+
+		w := o.callback(o.authorize(mt.T, "bob@example.com", nil))
+		if w.Code != http.StatusConflict {
+			mt.Fatalf("callback: status %d, want %d: %s", w.Code, http.StatusConflict, w.Body)
+		}
+		for e := mt.GetStartedEvent(); e != nil; e = mt.GetStartedEvent() {
+			if e.CommandName != "find" {
+				mt.Errorf("unexpected %s", e.CommandName)
+			}
+		}
+	})
+
+	mt.Run("invite-only registration", func(mt *mtest.T) {
+		// Runs after Setenv has restored the variable.
+		mt.Cleanup(func() { registration.ConfigFromEnv() })
+		mt.Setenv("REGISTRATION_MODE", registration.ModeInvite)
+		if err := registration.ConfigFromEnv(); err != nil {
+			mt.Fatal(err)
+		}
+
+		useMock(mt)
+		mt.AddMockResponses(none(mt), none(mt))
+
+		w := o.callback(o.authorize(mt.T, "new@example.com", nil))
+		if w.Code != http.StatusForbidden {
+			mt.Fatalf("callback: status %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+		}
+		if !strings.Contains(errorOf(mt.T, w), "invitation") {
+			mt.Errorf("error = %q", errorOf(mt.T, w))
+		}
+		for e := mt.GetStartedEvent(); e != nil; e = mt.GetStartedEvent() {
+			if e.CommandName == "insert" {
+				mt.Error("an account was created")
+			}
+		}
+	})
+}
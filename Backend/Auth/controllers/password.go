@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"authService.com/auth/apikeys"
+	"authService.com/auth/audit"
+	"authService.com/auth/mailer"
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+	"authService.com/auth/passwords"
+	"authService.com/auth/sessions"
+	"authService.com/auth/tokens"
+	"authService.com/auth/utils"
+)
+
+// passwordResetTTL is how long a password reset link stays valid.
+const passwordResetTTL = time.Hour
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required,min=6"`
+}
+
+func checkPassword(user *models.User, password string) bool {
+	return passwords.Verify(user.Password, password)
+}
+
+// breachedPassword answers 400 and returns true when password is on the
+// breach list, so it is never set on an account.
+func breachedPassword(c *gin.Context, path, password string) bool {
+	if !passwords.Breached(password) {
+		return false
+	}
+	metrics.HttpRequests.WithLabelValues(path, "400").Inc()
+	c.JSON(http.StatusBadRequest, gin.H{"error": "This password has appeared in a data breach; choose a different one"})
+	return true
+}
+
+// upgradePasswordHash replaces user's stored hash when it is weaker than the
+// current policy, using the password they just proved. Failures are only
+// logged: the old hash keeps working.
+func upgradePasswordHash(ctx context.Context, user *models.User, password string) {
+	if !passwords.NeedsRehash(user.Password) {
+		return
+	}
+	hashed, err := passwords.Hash(password)
+	if err != nil {
+		log.Printf("upgradePasswordHash: %v", err)
+		return
+	}
+
+	// Matching the old hash keeps a concurrent password change from being
+	// overwritten.
+	res, err := userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "password": user.Password},
+		bson.M{"$set": bson.M{"password": hashed}})
+	if err != nil {
+		log.Printf("upgradePasswordHash: failed to store hash for %s: %v", user.ID.Hex(), err)
+		return
+	}
+	if res.ModifiedCount > 0 {
+		user.Password = hashed
+		metrics.PasswordRehashes.Inc()
+	}
+}
+
+// resetBinding ties a reset token to the password hash it was issued for, so
+// any later password change invalidates every outstanding reset link.
+func resetBinding(user *models.User) string {
+	return user.ID.Hex() + "|" + utils.HashToken(user.Password)[:16]
+}
+
+// setPassword stores a new password hash for user and ends all of their
+// sessions, so a stolen session cannot outlive a password change.
+func setPassword(ctx context.Context, user *models.User, password string) error {
+	hashed, err := passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	res, err := userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"password": hashed}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	if _, err := sessions.RevokeAll(user.ID.Hex()); err != nil {
+		return err
+	}
+	// Whoever knew the old password may have created keys with it.
+	if _, err := apikeys.RevokeAll(ctx, user.ID.Hex()); err != nil {
+		return err
+	}
+
+	sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Rysto password was changed",
+		Body: "The password for your Rysto account was just changed, all devices were signed out " +
+			"and its API keys were revoked.\n\n" +
+			"If this was not you, reset your password immediately.",
+	})
+	return nil
+}
+
+// ForgotPassword mails a single-use reset link. The response is the same
+// whether or not the address is registered.
+func ForgotPassword(c *gin.Context) {
+	start := time.Now()
+
+	var input ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/password/forgot", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		metrics.HttpRequests.WithLabelValues("/password/forgot", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err == nil {
+		token, err := tokens.IssueOneTime(tokens.PurposePasswordReset, resetBinding(&user), passwordResetTTL)
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/password/forgot", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+			return
+		}
+
+		sendMail(mailer.Message{
+			To:      user.Email,
+			Subject: "Reset your Rysto password",
+			Body: "Someone asked to reset the password for your Rysto account.\n\n" +
+				"Choose a new password here:\n\n" +
+				link("/password/reset", token) + "\n\n" +
+				"The link works once and expires in 1 hour. If you did not ask for this, ignore this email.",
+		})
+	}
+
+	metrics.HttpRequests.WithLabelValues("/password/forgot", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/password/forgot").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists, a password reset email has been sent"})
+}
+
+// ResetPassword sets a new password using a reset token.
+func ResetPassword(c *gin.Context) {
+	start := time.Now()
+
+	var input ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/password/reset", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if breachedPassword(c, "/password/reset", input.Password) {
+		return
+	}
+
+	binding, err := tokens.ConsumeOneTime(tokens.PurposePasswordReset, input.Token)
+	if err == tokens.ErrInvalidToken {
+		metrics.HttpRequests.WithLabelValues("/password/reset", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/password/reset", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userID := binding
+	if i := strings.LastIndex(binding, "|"); i >= 0 {
+		userID = binding[:i]
+	}
+	var user models.User
+	if err := userCollection.FindOne(ctx, byID(userID)).Decode(&user); err != nil || resetBinding(&user) != binding {
+		metrics.HttpRequests.WithLabelValues("/password/reset", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	if err := setPassword(ctx, &user, input.Password); err != nil {
+		metrics.HttpRequests.WithLabelValues("/password/reset", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	recordEvent(c, audit.Event{
+		Type:    audit.TypePasswordChanged,
+		UserID:  user.ID.Hex(),
+		Details: map[string]string{"method": "reset"},
+	})
+	metrics.PasswordChanges.WithLabelValues("reset").Inc()
+	metrics.HttpRequests.WithLabelValues("/password/reset", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/password/reset").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset. Please log in again."})
+}
+
+// ChangePassword replaces the logged-in user's password after checking the
+// current one, then signs out every session including this one.
+func ChangePassword(c *gin.Context) {
+	start := time.Now()
+
+	var input ChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/password/change", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if breachedPassword(c, "/password/change", input.NewPassword) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, currentUser(c)).Decode(&user); err != nil {
+		metrics.HttpRequests.WithLabelValues("/password/change", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !checkPassword(&user, input.CurrentPassword) {
+		metrics.HttpRequests.WithLabelValues("/password/change", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	if err := setPassword(ctx, &user, input.NewPassword); err != nil {
+		metrics.HttpRequests.WithLabelValues("/password/change", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	recordEvent(c, audit.Event{
+		Type:    audit.TypePasswordChanged,
+		UserID:  user.ID.Hex(),
+		Details: map[string]string{"method": "change"},
+	})
+	metrics.PasswordChanges.WithLabelValues("change").Inc()
+	metrics.HttpRequests.WithLabelValues("/password/change", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/password/change").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed. Please log in again."})
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"authService.com/auth/apikeys"
+	"authService.com/auth/cascade"
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 500
+	maxAvatarURLLength   = 2048
+)
+
+// UpdateProfileInput holds the profile fields to change. Omitted fields are
+// left as they are; an empty string clears an optional field.
+type UpdateProfileInput struct {
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"displayName"`
+	Bio         *string `json:"bio"`
+	AvatarURL   *string `json:"avatarUrl"`
+}
+
+// GetPublicProfile returns the public profile behind a handle.
+func GetPublicProfile(c *gin.Context) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"handle": models.NormalizeHandle(c.Param("handle"))}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		metrics.HttpRequests.WithLabelValues("/users/handle", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/users/handle", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/users/handle", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/users/handle").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, user.Public())
+}
+
+// UpdateProfile changes the logged-in user's handle, display name, bio or
+// avatar. A new handle shows up in tokens from the next refresh on.
+func UpdateProfile(c *gin.Context) {
+	start := time.Now()
+
+	var input UpdateProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/profile/update", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	set, unset, msg := profileUpdate(&input)
+	if msg != "" {
+		metrics.HttpRequests.WithLabelValues("/profile/update", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if len(set) == 0 && len(unset) == 0 {
+		metrics.HttpRequests.WithLabelValues("/profile/update", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := userCollection.FindOneAndUpdate(ctx,
+		currentUser(c),
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if mongo.IsDuplicateKeyError(err) {
+		metrics.HttpRequests.WithLabelValues("/profile/update", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Handle already taken"})
+		return
+	}
+	if err == mongo.ErrNoDocuments {
+		metrics.HttpRequests.WithLabelValues("/profile/update", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/profile/update", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	if _, changed := set["handle"]; changed {
+		if err := apikeys.SetHandle(ctx, user.ID.Hex(), user.Handle); err != nil {
+			log.Printf("UpdateProfile: failed to update API keys of %s: %v", user.ID.Hex(), err)
+		}
+		if err := cascade.Rename(ctx, user.ID.Hex(), user.Handle); err != nil {
+			log.Printf("UpdateProfile: failed to rename the stories of %s: %v", user.ID.Hex(), err)
+		}
+	}
+
+	metrics.HttpRequests.WithLabelValues("/profile/update", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/profile/update").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, user.Public())
+}
+
+// profileUpdate validates input and splits it into fields to set and fields
+// to clear. msg is non-empty when the input is invalid.
+func profileUpdate(input *UpdateProfileInput) (set, unset bson.M, msg string) {
+	set, unset = bson.M{}, bson.M{}
+
+	if input.Handle != nil {
+		handle := models.NormalizeHandle(*input.Handle)
+		if !models.ValidHandle(handle) {
+			return nil, nil, "Handle must be 3-30 lowercase letters, digits or underscores"
+		}
+		set["handle"] = handle
+	}
+
+	optional := []struct {
+		field string
+		value *string
+		max   int
+	}{
+		{"displayName", input.DisplayName, maxDisplayNameLength},
+		{"bio", input.Bio, maxBioLength},
+		{"avatarUrl", input.AvatarURL, maxAvatarURLLength},
+	}
+	for _, f := range optional {
+		if f.value == nil {
+			continue
+		}
+		v := strings.TrimSpace(*f.value)
+		if v == "" {
+			unset[f.field] = ""
+			continue
+		}
+		if utf8.RuneCountInString(v) > f.max {
+			return nil, nil, f.field + " is too long"
+		}
+		set[f.field] = v
+	}
+
+	if v, ok := set["avatarUrl"].(string); ok {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, nil, "avatarUrl must be an http(s) URL"
+		}
+	}
+
+	return set, unset, ""
+}
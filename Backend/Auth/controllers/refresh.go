@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"authService.com/auth/audit"
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+	"authService.com/auth/sessions"
+	"authService.com/auth/tokens"
+	"authService.com/auth/utils"
+)
+
+type RefreshInput struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// Refresh exchanges a refresh token for a new access token and a rotated
+// refresh token. The presented refresh token can never be used again.
+func Refresh(c *gin.Context) {
+	start := time.Now()
+
+	var input RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/refresh", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, family, refreshToken, err := tokens.Rotate(input.RefreshToken, "")
+	switch {
+	case err == tokens.ErrRefreshTokenReused:
+		log.Printf("Refresh: reuse detected for user %s, session revoked", userID)
+		recordEvent(c, audit.Event{
+			Type:      audit.TypeSessionRevoked,
+			UserID:    userID,
+			SessionID: family,
+			Details:   map[string]string{"reason": "refresh_token_reuse"},
+		})
+		metrics.RefreshTokenReuse.Inc()
+		metrics.HttpRequests.WithLabelValues("/refresh", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, session revoked"})
+		return
+	case err == tokens.ErrInvalidRefreshToken:
+		metrics.HttpRequests.WithLabelValues("/refresh", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	case err != nil:
+		metrics.HttpRequests.WithLabelValues("/refresh", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate refresh token"})
+		return
+	}
+
+	// Claims are rebuilt from the user document, so changes such as a newly
+	// verified email reach the next access token.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, byID(userID)).Decode(&user); err != nil {
+		_ = sessions.Revoke(userID, family)
+		metrics.HttpRequests.WithLabelValues("/refresh", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account no longer exists"})
+		return
+	}
+	if status := user.Restriction(time.Now()); status != nil {
+		_ = sessions.Revoke(userID, family)
+		metrics.HttpRequests.WithLabelValues("/refresh", "403").Inc()
+		c.JSON(http.StatusForbidden, restrictionBody(status))
+		return
+	}
+
+	token, err := issueAccessToken(&user, family)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/refresh", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	metrics.TokenRefreshes.Inc()
+	metrics.HttpRequests.WithLabelValues("/refresh", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/refresh").Observe(time.Since(start).Seconds())
+
+	c.JSON(http.StatusOK, LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+		Message:      "Token refreshed",
+	})
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"authService.com/auth/audit"
+	"authService.com/auth/metrics"
+	"authService.com/auth/sessions"
+)
+
+// ListSessions returns every active session of the logged-in user.
+func ListSessions(c *gin.Context) {
+	start := time.Now()
+
+	list, err := sessions.List(c.GetString("userId"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/sessions", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sessions"})
+		return
+	}
+
+	current := c.GetString("sessionId")
+	for i := range list {
+		list[i].Current = list[i].ID == current
+	}
+
+	metrics.HttpRequests.WithLabelValues("/sessions", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/sessions").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, list)
+}
+
+// RevokeSession ends one of the logged-in user's sessions.
+func RevokeSession(c *gin.Context) {
+	start := time.Now()
+
+	err := sessions.Revoke(c.GetString("userId"), c.Param("id"))
+	if err == sessions.ErrNotFound {
+		metrics.HttpRequests.WithLabelValues("/sessions/revoke", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/sessions/revoke", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	recordEvent(c, audit.Event{
+		Type:    audit.TypeSessionRevoked,
+		UserID:  c.GetString("userId"),
+		Details: map[string]string{"session": c.Param("id")},
+	})
+
+	metrics.HttpRequests.WithLabelValues("/sessions/revoke", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/sessions/revoke").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// LogoutAll ends every session of the logged-in user, including the current one.
+func LogoutAll(c *gin.Context) {
+	start := time.Now()
+
+	revoked, err := sessions.RevokeAll(c.GetString("userId"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/logout-all", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	recordEvent(c, audit.Event{
+		Type:    audit.TypeLogoutAll,
+		UserID:  c.GetString("userId"),
+		Details: map[string]string{"revoked": strconv.Itoa(revoked)},
+	})
+
+	metrics.HttpRequests.WithLabelValues("/logout-all", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/logout-all").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out everywhere", "revoked": revoked})
+}
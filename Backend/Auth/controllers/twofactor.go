@@ -0,0 +1,351 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+	"authService.com/auth/tokens"
+	"authService.com/auth/totp"
+	"authService.com/auth/utils"
+)
+
+const (
+	totpIssuer        = "Rysto"
+	recoveryCodeCount = 10
+)
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorInput struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type LoginTwoFactorInput struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+// normalizeRecoveryCode makes recovery codes case- and dash-insensitive.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// generateRecoveryCodes returns fresh codes for the user and their digests
+// for storage.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	digests := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := totp.GenerateSecret()
+		if err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(raw[:5] + "-" + raw[5:10])
+		codes = append(codes, code)
+		digests = append(digests, utils.HashToken(normalizeRecoveryCode(code)))
+	}
+	return codes, digests, nil
+}
+
+// checkTOTP validates code against the user's encrypted secret and makes sure
+// the same code cannot be used twice.
+func checkTOTP(user *models.User, encryptedSecret, code string) (bool, error) {
+	secret, err := utils.Decrypt(encryptedSecret)
+	if err != nil {
+		return false, err
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return tokens.MarkTOTPUsed(user.ID.Hex(), step)
+}
+
+// useRecoveryCode consumes one of the user's recovery codes.
+func useRecoveryCode(ctx context.Context, user *models.User, code string) (bool, error) {
+	digest := utils.HashToken(normalizeRecoveryCode(code))
+	res, err := userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "recoveryCodes": digest},
+		bson.M{"$pull": bson.M{"recoveryCodes": digest}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// EnrollTwoFactor creates a pending TOTP secret for the logged-in user. It
+// only takes effect once confirmed with a first code.
+func EnrollTwoFactor(c *gin.Context) {
+	start := time.Now()
+
+	if !utils.EncryptionEnabled() {
+		metrics.HttpRequests.WithLabelValues("/2fa/enroll", "503").Inc()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Two-factor authentication is not configured"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, currentUser(c)).Decode(&user); err != nil {
+		metrics.HttpRequests.WithLabelValues("/2fa/enroll", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TOTPEnabled {
+		metrics.HttpRequests.WithLabelValues("/2fa/enroll", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/2fa/enroll", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	encrypted, err := utils.Encrypt(secret)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/2fa/enroll", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to protect secret"})
+		return
+	}
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"totpPendingSecret": encrypted}})
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/2fa/enroll", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/2fa/enroll", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/2fa/enroll").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{
+		"secret":     secret,
+		"otpauthUri": totp.URI(totpIssuer, user.Email, secret),
+		"message":    "Scan the code in your authenticator app, then confirm with a generated code",
+	})
+}
+
+// ConfirmTwoFactor activates the pending secret after checking a first code
+// and returns the recovery codes, which are shown only this once.
+func ConfirmTwoFactor(c *gin.Context) {
+	start := time.Now()
+
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/2fa/confirm", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, currentUser(c)).Decode(&user); err != nil {
+		metrics.HttpRequests.WithLabelValues("/2fa/confirm", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TOTPPendingSecret == "" {
+		metrics.HttpRequests.WithLabelValues("/2fa/confirm", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "No two-factor enrollment in progress"})
+		return
+	}
+
+	ok, err := checkTOTP(&user, user.TOTPPendingSecret, input.Code)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/2fa/confirm", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !ok {
+		metrics.HttpRequests.WithLabelValues("/2fa/confirm", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, digests, err := generateRecoveryCodes()
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/2fa/confirm", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{
+			"totpEnabled":   true,
+			"totpSecret":    user.TOTPPendingSecret,
+			"recoveryCodes": digests,
+		},
+		"$unset": bson.M{"totpPendingSecret": ""},
+	})
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/2fa/confirm", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/2fa/confirm", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/2fa/confirm").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Two-factor authentication enabled. Store these recovery codes somewhere safe.",
+		"recoveryCodes": codes,
+	})
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking both
+// the password and a current code.
+func DisableTwoFactor(c *gin.Context) {
+	start := time.Now()
+
+	var input DisableTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/2fa/disable", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, currentUser(c)).Decode(&user); err != nil {
+		metrics.HttpRequests.WithLabelValues("/2fa/disable", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !user.TOTPEnabled {
+		metrics.HttpRequests.WithLabelValues("/2fa/disable", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if !checkPassword(&user, input.Password) {
+		metrics.HttpRequests.WithLabelValues("/2fa/disable", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password or code"})
+		return
+	}
+	ok, err := checkTOTP(&user, user.TOTPSecret, input.Code)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/2fa/disable", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !ok {
+		metrics.HttpRequests.WithLabelValues("/2fa/disable", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password or code"})
+		return
+	}
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set":   bson.M{"totpEnabled": false},
+		"$unset": bson.M{"totpSecret": "", "totpPendingSecret": "", "recoveryCodes": ""},
+	})
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/2fa/disable", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/2fa/disable", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/2fa/disable").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// LoginTwoFactor completes a login started by Login, exchanging the challenge
+// token and a TOTP or recovery code for a session.
+func LoginTwoFactor(c *gin.Context) {
+	start := time.Now()
+
+	var input LoginTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/login/2fa", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (input.Code == "") == (input.RecoveryCode == "") {
+		metrics.HttpRequests.WithLabelValues("/login/2fa", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either code or recoveryCode"})
+		return
+	}
+
+	userID, err := tokens.AttemptChallenge(input.ChallengeToken)
+	if err == tokens.ErrInvalidToken {
+		metrics.FailedLogins.Inc()
+		metrics.HttpRequests.WithLabelValues("/login/2fa", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge, log in again"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/login/2fa", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify challenge"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, byID(userID)).Decode(&user); err != nil || !user.TOTPEnabled {
+		metrics.HttpRequests.WithLabelValues("/login/2fa", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge, log in again"})
+		return
+	}
+
+	if throttled(c, "/login/2fa", user.Email) {
+		return
+	}
+	if refuseRestricted(c, "/login/2fa", &user) {
+		return
+	}
+
+	var ok bool
+	method := "totp"
+	if input.Code != "" {
+		ok, err = checkTOTP(&user, user.TOTPSecret, input.Code)
+	} else {
+		method = "recovery_code"
+		ok, err = useRecoveryCode(ctx, &user, input.RecoveryCode)
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/login/2fa", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !ok {
+		loginFailed(c, user.Email, userID, "wrong_code")
+		metrics.HttpRequests.WithLabelValues("/login/2fa", "401").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	_ = tokens.CompleteChallenge(input.ChallengeToken)
+
+	resp, err := startSession(c, &user, method)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/login/2fa", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	loginSucceeded(user.Email)
+	metrics.SuccessfulLogins.Inc()
+	metrics.HttpRequests.WithLabelValues("/login/2fa", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/login/2fa").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, resp)
+}
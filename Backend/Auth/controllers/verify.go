@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"authService.com/auth/mailer"
+	"authService.com/auth/metrics"
+	"authService.com/auth/models"
+	"authService.com/auth/tokens"
+)
+
+// verificationTTL is how long an email verification link stays valid.
+const verificationTTL = 24 * time.Hour
+
+type VerifyInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResendVerificationInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// sendVerificationEmail issues a verification token for email and mails it.
+func sendVerificationEmail(email string) error {
+	token, err := tokens.IssueOneTime(tokens.PurposeVerifyEmail, email, verificationTTL)
+	if err != nil {
+		return err
+	}
+
+	sendMail(mailer.Message{
+		To:      email,
+		Subject: "Verify your Rysto email address",
+		Body: "Welcome to Rysto!\n\n" +
+			"Confirm your email address to start writing and voting:\n\n" +
+			link("/verify", token) + "\n\n" +
+			"The link expires in 24 hours. If you did not sign up, ignore this email.",
+	})
+	return nil
+}
+
+// VerifyEmail marks the account owning a verification token as verified.
+func VerifyEmail(c *gin.Context) {
+	start := time.Now()
+
+	var input VerifyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/verify", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email, err := tokens.ConsumeOneTime(tokens.PurposeVerifyEmail, input.Token)
+	if err == tokens.ErrInvalidToken {
+		metrics.HttpRequests.WithLabelValues("/verify", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/verify", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	res, err := userCollection.UpdateOne(ctx,
+		bson.M{"email": email},
+		bson.M{"$set": bson.M{"verified": true, "verifiedAt": now}},
+	)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/verify", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		metrics.HttpRequests.WithLabelValues("/verify", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account no longer exists"})
+		return
+	}
+
+	metrics.EmailsVerified.Inc()
+	metrics.HttpRequests.WithLabelValues("/verify", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/verify").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified. Refresh your session to start writing and voting."})
+}
+
+// ResendVerification mails a fresh verification link. The response is the
+// same whether or not the address is registered, so it cannot be used to
+// probe for accounts.
+func ResendVerification(c *gin.Context) {
+	start := time.Now()
+
+	var input ResendVerificationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/verify/resend", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		metrics.HttpRequests.WithLabelValues("/verify/resend", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err == nil && !user.Verified {
+		if err := sendVerificationEmail(user.Email); err != nil {
+			metrics.HttpRequests.WithLabelValues("/verify/resend", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create verification token"})
+			return
+		}
+	}
+
+	metrics.HttpRequests.WithLabelValues("/verify/resend", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/verify/resend").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists and is unverified, a verification email has been sent"})
+}
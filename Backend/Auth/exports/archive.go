@@ -0,0 +1,132 @@
+package exports
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"authService.com/auth/cascade"
+	"authService.com/auth/models"
+	"authService.com/auth/sessions"
+)
+
+// archive is everything that goes into one export.
+type archive struct {
+	GeneratedAt time.Time
+	User        *models.User
+	Sessions    []sessions.Session
+	Content     *cascade.Export
+}
+
+// writeArchive writes the ZIP for t to w.
+func writeArchive(w io.Writer, t *archive) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		v    any
+	}{
+		{"profile.json", map[string]any{"profile": t.User, "sessions": t.Sessions}},
+		{"stories.json", t.Content.Stories},
+		{"votes.json", t.Content.Votes},
+	}
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: t.GeneratedAt})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.v); err != nil {
+			return err
+		}
+	}
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: "README.md", Method: zip.Deflate, Modified: t.GeneratedAt})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw, renderMarkdown(t)); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+const dateFormat = "2 January 2006, 15:04 MST"
+
+// renderMarkdown is the human-readable version of the export.
+func renderMarkdown(t *archive) string {
+	var b strings.Builder
+	u := t.User
+
+	fmt.Fprintf(&b, "# Rysto data export\n\n")
+	fmt.Fprintf(&b, "Generated on %s for @%s. The JSON files next to this one hold the same data in machine-readable form.\n\n", t.GeneratedAt.Format(dateFormat), u.Handle)
+	if len(t.Content.Skipped) > 0 {
+		fmt.Fprintf(&b, "> Not included, because the service was unavailable to the export: %s.\n\n", strings.Join(t.Content.Skipped, ", "))
+	}
+
+	fmt.Fprintf(&b, "## Profile\n\n")
+	fmt.Fprintf(&b, "- Handle: @%s\n", u.Handle)
+	if u.DisplayName != "" {
+		fmt.Fprintf(&b, "- Display name: %s\n", u.DisplayName)
+	}
+	fmt.Fprintf(&b, "- Email: %s (%s)\n", u.Email, yesNo(u.Verified, "verified", "not verified"))
+	fmt.Fprintf(&b, "- Member since: %s\n", u.CreatedAt.Format(dateFormat))
+	fmt.Fprintf(&b, "- Roles: %s\n", strings.Join(u.Roles, ", "))
+	fmt.Fprintf(&b, "- Two-factor authentication: %s\n", yesNo(u.TOTPEnabled, "enabled", "disabled"))
+	if u.AvatarURL != "" {
+		fmt.Fprintf(&b, "- Avatar: %s\n", u.AvatarURL)
+	}
+	if u.Bio != "" {
+		fmt.Fprintf(&b, "\n%s\n", quote(u.Bio))
+	}
+
+	fmt.Fprintf(&b, "\n## Active sessions (%d)\n\n", len(t.Sessions))
+	for _, s := range t.Sessions {
+		fmt.Fprintf(&b, "- %s from %s, last used %s\n", s.UserAgent, s.IP, s.LastSeen.Format(dateFormat))
+	}
+
+	stories := t.Content.Stories
+	fmt.Fprintf(&b, "\n## Stories (%d)\n", len(stories.Stories))
+	for _, s := range stories.Stories {
+		fmt.Fprintf(&b, "\n### %s\n\n", s.Title)
+		fmt.Fprintf(&b, "*Written %s", s.CreatedAt.Format(dateFormat))
+		if len(s.Tags) > 0 {
+			fmt.Fprintf(&b, " · tags: %s", strings.Join(s.Tags, ", "))
+		}
+		fmt.Fprintf(&b, "*\n\n%s\n", s.Content)
+	}
+
+	fmt.Fprintf(&b, "\n## Continuations (%d)\n", len(stories.Continuations))
+	for _, c := range stories.Continuations {
+		title := c.StoryTitle
+		if title == "" {
+			title = "a deleted story"
+		}
+		fmt.Fprintf(&b, "\n### On “%s”\n\n", title)
+		fmt.Fprintf(&b, "*Written %s%s*\n\n%s\n", c.CreatedAt.Format(dateFormat), yesNo(c.Accepted, " · accepted", ""), c.Content)
+	}
+
+	votes := t.Content.Votes.Votes
+	fmt.Fprintf(&b, "\n## Votes (%d)\n\n", len(votes))
+	for _, v := range votes {
+		fmt.Fprintf(&b, "- %s: continuation %s\n", v.VotedAt.Format(dateFormat), v.ContinuationID)
+	}
+
+	return b.String()
+}
+
+func yesNo(v bool, yes, no string) string {
+	if v {
+		return yes
+	}
+	return no
+}
+
+func quote(s string) string {
+	return "> " + strings.ReplaceAll(s, "\n", "\n> ")
+}
@@ -0,0 +1,111 @@
+package exports
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"authService.com/auth/cascade"
+	"authService.com/auth/models"
+	"authService.com/auth/sessions"
+)
+
+var dir = "data/exports"
+
+// SetDir sets the directory finished archives are written to, creating it if
+// needed.
+func SetDir(d string) error {
+	dir = d
+	return os.MkdirAll(dir, 0700)
+}
+
+// Path returns the archive file of a job.
+func Path(id string) string {
+	return filepath.Join(dir, id+".zip")
+}
+
+// Start builds the export for job in the background.
+func Start(job *Job, user *models.User) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), staleAfter)
+		defer cancel()
+
+		if err := setStatus(job.ID, StatusRunning, ""); err != nil {
+			log.Printf("Export %s: failed to update status: %v", job.ID, err)
+		}
+
+		if err := build(ctx, job, user); err != nil {
+			log.Printf("Export %s failed: %v", job.ID, err)
+			_ = os.Remove(Path(job.ID))
+			if err := setStatus(job.ID, StatusFailed, "Could not collect all of your data, please try again later"); err != nil {
+				log.Printf("Export %s: failed to update status: %v", job.ID, err)
+			}
+			return
+		}
+
+		if err := setStatus(job.ID, StatusReady, ""); err != nil {
+			log.Printf("Export %s: failed to update status: %v", job.ID, err)
+		}
+	}()
+}
+
+func build(ctx context.Context, job *Job, user *models.User) error {
+	list, err := sessions.List(job.UserID)
+	if err != nil {
+		return err
+	}
+	content, err := cascade.Collect(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary name so a half-written archive is never served.
+	tmp := Path(job.ID) + ".part"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = writeArchive(f, &archive{
+		GeneratedAt: time.Now().UTC(),
+		User:        user,
+		Sessions:    list,
+		Content:     content,
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, Path(job.ID))
+}
+
+// StartJanitor deletes archives older than TTL once an hour.
+func StartJanitor() {
+	go func() {
+		for {
+			cleanup()
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+func cleanup() {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("Exports: failed to list %s: %v", dir, err)
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() || time.Since(info.ModTime()) < TTL {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			log.Printf("Exports: failed to remove %s: %v", e.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Package exports builds personal data exports ("takeout"): a ZIP with the
+// user's Auth profile, stories, continuations and votes as JSON plus a
+// Markdown rendering. Exports run in the background; their state lives in
+// Redis and the finished archives on disk.
+package exports
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"authService.com/auth/utils"
+
+	"rysto/pkg/redis"
+)
+
+// TTL is how long a finished export can be downloaded.
+const TTL = 48 * time.Hour
+
+// staleAfter is when a job that is still running is considered lost, e.g.
+// because the service restarted while building it.
+const staleAfter = 15 * time.Minute
+
+// Job statuses.
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+var ErrNotFound = errors.New("export not found")
+
+// Job is one export request.
+type Job struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"-"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Redis layout:
+//
+//	export:<id>             hash {user, status, createdAt, completedAt, error}
+//	export_user:<userId>    string, ID of the user's latest export
+func jobKey(id string) string      { return "export:" + id }
+func userKey(userID string) string { return "export_user:" + userID }
+
+// Create registers a new pending export for the user. If the user's latest
+// export is still in progress, that job is returned instead with created
+// set to false. The check and the write happen in one transaction, so two
+// concurrent requests never both start an export.
+func Create(userID string) (job *Job, created bool, err error) {
+	id, err := utils.GenerateOpaqueToken(16)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// A concurrent request that registered its job first makes the
+	// transaction fail; the retry then finds that job in progress.
+	for attempt := 0; attempt < 3; attempt++ {
+		job, created, err = create(userID, id)
+		if err != goredis.TxFailedErr {
+			return job, created, err
+		}
+	}
+	return nil, false, err
+}
+
+func create(userID, id string) (job *Job, created bool, err error) {
+	err = redis.Client.Watch(redis.Ctx, func(tx *goredis.Tx) error {
+		latest, err := tx.Get(redis.Ctx, userKey(userID)).Result()
+		if err != nil && err != goredis.Nil {
+			return err
+		}
+		if latest != "" {
+			current, err := Get(latest)
+			if err != nil && err != ErrNotFound {
+				return err
+			}
+			if current != nil && (current.Status == StatusPending || current.Status == StatusRunning) {
+				job = current
+				return nil
+			}
+		}
+
+		now := time.Now()
+		_, err = tx.TxPipelined(redis.Ctx, func(pipe goredis.Pipeliner) error {
+			pipe.HSet(redis.Ctx, jobKey(id),
+				"user", userID,
+				"status", StatusPending,
+				"createdAt", now.Unix(),
+			)
+			pipe.Expire(redis.Ctx, jobKey(id), TTL)
+			pipe.Set(redis.Ctx, userKey(userID), id, TTL)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		job = &Job{
+			ID:        id,
+			UserID:    userID,
+			Status:    StatusPending,
+			CreatedAt: now.UTC().Truncate(time.Second),
+			ExpiresAt: now.Add(TTL).UTC().Truncate(time.Second),
+		}
+		created = true
+		return nil
+	}, userKey(userID))
+	if err != nil {
+		return nil, false, err
+	}
+	return job, created, nil
+}
+
+// Get loads a job.
+func Get(id string) (*Job, error) {
+	fields, err := redis.Client.HGetAll(redis.Ctx, jobKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrNotFound
+	}
+
+	job := &Job{
+		ID:        id,
+		UserID:    fields["user"],
+		Status:    fields["status"],
+		CreatedAt: unixField(fields["createdAt"]),
+		Error:     fields["error"],
+	}
+	job.ExpiresAt = job.CreatedAt.Add(TTL)
+	if fields["completedAt"] != "" {
+		t := unixField(fields["completedAt"])
+		job.CompletedAt = &t
+	}
+
+	if (job.Status == StatusPending || job.Status == StatusRunning) && time.Since(job.CreatedAt) > staleAfter {
+		job.Status = StatusFailed
+		job.Error = "Export was interrupted, please request a new one"
+	}
+	return job, nil
+}
+
+func setStatus(id, status, errMsg string) error {
+	values := []any{"status", status}
+	if status == StatusReady || status == StatusFailed {
+		values = append(values, "completedAt", time.Now().Unix())
+	}
+	if errMsg != "" {
+		values = append(values, "error", errMsg)
+	}
+	return redis.Client.HSet(redis.Ctx, jobKey(id), values...).Err()
+}
+
+func unixField(v string) time.Time {
+	sec, _ := strconv.ParseInt(v, 10, 64)
+	return time.Unix(sec, 0).UTC()
+}
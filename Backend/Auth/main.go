@@ -5,19 +5,33 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"authService.com/auth/apikeys"
+	"authService.com/auth/audit"
+	"authService.com/auth/cascade"
 	"authService.com/auth/controllers"
+	"authService.com/auth/exports"
+	"authService.com/auth/mailer"
 	"authService.com/auth/middleware"
 	"authService.com/auth/metrics"
-	"authService.com/auth/redis"
+	"authService.com/auth/models"
+	"authService.com/auth/oidc"
+	"authService.com/auth/passwords"
+	"authService.com/auth/ratelimit"
+	"authService.com/auth/registration"
+	"authService.com/auth/sessions"
 	"authService.com/auth/utils"
+
+	pkgmetrics "rysto/pkg/metrics"
+	"rysto/pkg/redis"
+	"rysto/pkg/token"
 )
 
 func main() {
@@ -34,12 +48,57 @@ func main() {
 	}
 	gin.SetMode(ginMode)
 
-	// --- JWT Secret ---
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("Error: JWT_SECRET not set")
+	// --- JWT signing keys ---
+	// JWT_SIGNING_KEYS lists PEM private keys (RSA or Ed25519), newest first.
+	// Without it, tokens fall back to HS256 with the shared JWT_SECRET.
+	if signingKeys := os.Getenv("JWT_SIGNING_KEYS"); signingKeys != "" {
+		if err := utils.LoadSigningKeys(signingKeys); err != nil {
+			log.Fatalf("Error loading JWT signing keys: %v", err)
+		}
+		log.Printf("Signing tokens with key %s", utils.JWKS().Keys[0].Kid)
+	} else {
+		jwtSecret := os.Getenv("JWT_SECRET")
+		if jwtSecret == "" {
+			log.Fatal("Error: JWT_SIGNING_KEYS or JWT_SECRET must be set")
+		}
+		log.Println("Warning: JWT_SIGNING_KEYS not set, signing tokens with the shared HS256 secret.")
+		utils.SetJWTSecret([]byte(jwtSecret))
+	}
+
+	// --- Encryption key for secrets at rest (TOTP) ---
+	if key := os.Getenv("TOTP_ENCRYPTION_KEY"); key != "" {
+		if err := utils.SetEncryptionKey(key); err != nil {
+			log.Fatalf("Error: invalid TOTP_ENCRYPTION_KEY: %v", err)
+		}
+	} else {
+		log.Println("Warning: TOTP_ENCRYPTION_KEY not set, two-factor enrollment is disabled.")
+	}
+
+	// --- Password hashing ---
+	// Hashes made under a weaker policy are replaced at the user's next login.
+	hasher, err := passwords.FromEnv()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	passwords.SetPolicy(hasher)
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		n, err := passwords.LoadBreached(path)
+		if err != nil {
+			log.Fatalf("Failed to load breached passwords: %v", err)
+		}
+		log.Printf("Loaded %d breached password hashes", n)
+	}
+
+	// --- Registration mode ---
+	if err := registration.ConfigFromEnv(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Printf("Registration mode: %s", registration.Mode())
+
+	// --- Login rate limits ---
+	if err := ratelimit.ConfigFromEnv(); err != nil {
+		log.Fatalf("Error: %v", err)
 	}
-	utils.SetJWTSecret([]byte(jwtSecret))
 
 	// --- Redis ---
 	redisAddr := os.Getenv("REDIS_ADDR")
@@ -86,18 +145,189 @@ func main() {
 	userCollection := client.Database("RystoDB").Collection("users")
 	controllers.SetUserCollection(userCollection)
 
+	clientCollection := client.Database("RystoDB").Collection("oauth_clients")
+	controllers.SetClientCollection(clientCollection)
+	if err := models.EnsureClientIndexes(ctx, clientCollection); err != nil {
+		log.Fatalf("Failed to create OAuth client indexes: %v", err)
+	}
+
+	// --- Security audit log ---
+	retention := audit.DefaultRetention
+	if v := os.Getenv("AUDIT_RETENTION"); v != "" {
+		if retention, err = time.ParseDuration(v); err != nil || retention <= 0 {
+			log.Fatalf("Error: invalid AUDIT_RETENTION %q", v)
+		}
+	}
+	audit.SetCollection(client.Database("RystoDB").Collection("audit_events"))
+	if err := audit.EnsureIndexes(ctx, retention); err != nil {
+		log.Fatalf("Failed to create audit log indexes: %v", err)
+	}
+
+	apikeys.SetCollection(client.Database("RystoDB").Collection("api_keys"))
+	if err := apikeys.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create API key indexes: %v", err)
+	}
+
+	inviteCollection := client.Database("RystoDB").Collection("invites")
+	controllers.SetInviteCollection(inviteCollection)
+	if err := models.EnsureInviteIndexes(ctx, inviteCollection); err != nil {
+		log.Fatalf("Failed to create invite indexes: %v", err)
+	}
+
+	if n, err := models.BackfillVerified(ctx, userCollection); err != nil {
+		log.Fatalf("Failed to backfill verified flag: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d existing users as verified", n)
+	}
+
+	if err := models.EnsureIndexes(ctx, userCollection); err != nil {
+		log.Fatalf("Failed to create user indexes: %v", err)
+	}
+	if n, err := models.BackfillProfiles(ctx, userCollection); err != nil {
+		log.Fatalf("Failed to backfill profiles: %v", err)
+	} else if n > 0 {
+		log.Printf("Gave %d existing users a handle", n)
+	}
+
+	if n, err := models.BackfillRoles(ctx, userCollection); err != nil {
+		log.Fatalf("Failed to backfill roles: %v", err)
+	} else if n > 0 {
+		log.Printf("Gave %d existing users the user role", n)
+	}
+
+	// ADMIN_EMAILS bootstraps the first admins; further roles are granted
+	// through /api/admin.
+	if adminEmails := os.Getenv("ADMIN_EMAILS"); adminEmails != "" {
+		var emails []string
+		for _, e := range strings.Split(adminEmails, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				emails = append(emails, e)
+			}
+		}
+		if n, err := models.BootstrapAdmins(ctx, userCollection, emails); err != nil {
+			log.Fatalf("Failed to bootstrap admins: %v", err)
+		} else if n > 0 {
+			log.Printf("Granted admin role to %d users from ADMIN_EMAILS", n)
+		}
+	}
+
+	// Suspensions and bans live in Redis for the services; restore them in
+	// case Redis started empty.
+	if n, err := controllers.PublishUserStatuses(ctx); err != nil {
+		log.Fatalf("Failed to publish suspended and banned users: %v", err)
+	} else if n > 0 {
+		log.Printf("Published the status of %d suspended or banned users", n)
+	}
+
+	// API keys are kept in MongoDB and looked up in Redis; move keys from
+	// before that split over, then restore the lookups.
+	if n, err := apikeys.ImportFromRedis(ctx); err != nil {
+		log.Fatalf("Failed to import API keys from Redis: %v", err)
+	} else if n > 0 {
+		log.Printf("Moved %d API keys from Redis to MongoDB", n)
+	}
+	if n, err := apikeys.PublishAll(ctx); err != nil {
+		log.Fatalf("Failed to publish API keys: %v", err)
+	} else if n > 0 {
+		log.Printf("Published %d API keys", n)
+	}
+
+	// --- Mailer ---
+	m, err := mailer.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure mailer: %v", err)
+	}
+	controllers.SetMailer(m)
+	// APP_URL is the web app serving the pages emailed links open (see
+	// controllers/mail.go); mail that leaves the machine needs it.
+	if appURL := os.Getenv("APP_URL"); appURL != "" {
+		controllers.SetAppURL(appURL)
+	} else if os.Getenv("MAIL_DRIVER") == "smtp" {
+		log.Fatal("Error: APP_URL must be set when MAIL_DRIVER is smtp")
+	} else {
+		log.Println("Warning: APP_URL not set, links in emails are relative.")
+	}
+
+	// --- Services holding user content, purged on account deletion ---
+	services := cascade.ServicesFromEnv()
+	for _, svc := range services {
+		if svc.BaseURL == "" {
+			log.Printf("Warning: no URL for the %s service, accounts cannot be deleted.", svc.Name)
+		}
+	}
+	cascade.SetServices(services)
+
+	// --- Token introspection for the other services ---
+	// Services holding INTROSPECTION_SECRET may ask POST /introspect about
+	// tokens instead of reading Redis.
+	if secret := os.Getenv("INTROSPECTION_SECRET"); secret != "" {
+		controllers.SetIntrospectionSecret(secret)
+	} else {
+		log.Println("INTROSPECTION_SECRET not set; /introspect is disabled")
+	}
+
+	// --- External identity providers ---
+	// AUTH_PUBLIC_URL is where browsers reach this service; providers send
+	// users back to <AUTH_PUBLIC_URL>/oauth/<id>/callback.
+	publicURL := os.Getenv("AUTH_PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:8080"
+	}
+	providers, err := oidc.ProvidersFromEnv(publicURL)
+	if err != nil {
+		log.Fatalf("Failed to configure identity providers: %v", err)
+	}
+	oidc.SetProviders(providers)
+	for _, p := range providers {
+		log.Printf("Sign-in with %s enabled (%s)", p.Name, p.Issuer)
+	}
+
+	// --- Data exports ---
+	exportDir := os.Getenv("EXPORT_DIR")
+	if exportDir == "" {
+		exportDir = "data/exports"
+	}
+	if err := exports.SetDir(exportDir); err != nil {
+		log.Fatalf("Failed to create export directory: %v", err)
+	}
+	exports.StartJanitor()
+
 	// --- Setup Gin routes ---
 	r := gin.Default()
 
 	// 🔹 Attach metrics middleware
 	r.Use(metrics.PrometheusMiddleware())
+	metrics.RegisterActiveSessions(sessions.CountActive)
 
 	// Prometheus endpoint
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/metrics", pkgmetrics.Handler())
 
 	// Public routes
+	r.GET("/.well-known/jwks.json", controllers.JWKS)
 	r.POST("/register", controllers.Register)
+	r.GET("/register/mode", controllers.RegistrationMode)
 	r.POST("/login", controllers.Login)
+	r.POST("/login/2fa", controllers.LoginTwoFactor)
+	r.POST("/login/unlock", controllers.UnlockAccount)
+	r.POST("/login/magic", controllers.RequestMagicLink)
+	r.GET("/login/magic/:token", controllers.MagicLogin)
+	r.POST("/refresh", controllers.Refresh)
+	r.POST("/introspect", controllers.IntrospectToken)
+	r.POST("/verify", controllers.VerifyEmail)
+	r.POST("/verify/resend", controllers.ResendVerification)
+	r.POST("/password/forgot", controllers.ForgotPassword)
+	r.POST("/password/reset", controllers.ResetPassword)
+	r.POST("/email/confirm", controllers.ConfirmEmailChange)
+	r.GET("/users/:handle", controllers.GetPublicProfile)
+	r.GET("/oauth/providers", controllers.ListProviders)
+	r.GET("/oauth/:provider/login", controllers.OIDCLogin)
+	r.GET("/oauth/:provider/callback", controllers.OIDCCallback)
+	r.POST("/oauth/complete", controllers.CompleteOIDCLogin)
+
+	// OAuth 2.0 authorization server for third-party apps
+	r.GET("/oauth/authorize", controllers.Authorize)
+	r.POST("/oauth/token", controllers.Token)
+	r.POST("/oauth/introspect", controllers.Introspect)
 
 	// Protected routes
 	projectURL := os.Getenv("PROJECT_URL")
@@ -117,12 +347,54 @@ func main() {
 			c.JSON(http.StatusOK, gin.H{
 				"message":      "Welcome to your protected profile!",
 				"user_email":   email,
+				"user_handle":  c.GetString("handle"),
 				"project_url":  projectURL,
 				"access_level": "authenticated",
 			})
 		})
 
+		protected.PATCH("/profile", controllers.UpdateProfile)
+
 		protected.POST("/logout", controllers.Logout)
+		protected.POST("/logout-all", controllers.LogoutAll)
+		protected.POST("/password/change", controllers.ChangePassword)
+		protected.POST("/email/change", controllers.ChangeEmail)
+		protected.DELETE("/account", controllers.DeleteAccount)
+		protected.POST("/export", controllers.RequestExport)
+		protected.GET("/export/:id", controllers.GetExport)
+		protected.GET("/export/:id/download", controllers.DownloadExport)
+		protected.POST("/2fa/enroll", controllers.EnrollTwoFactor)
+		protected.POST("/2fa/confirm", controllers.ConfirmTwoFactor)
+		protected.POST("/2fa/disable", controllers.DisableTwoFactor)
+		protected.GET("/security/events", controllers.ListSecurityEvents)
+		protected.POST("/invites", controllers.CreateInvite)
+		protected.GET("/invites", controllers.ListInvites)
+		protected.DELETE("/invites/:code", controllers.RevokeInvite)
+		protected.GET("/sessions", controllers.ListSessions)
+		protected.DELETE("/sessions/:id", controllers.RevokeSession)
+		protected.POST("/keys", controllers.CreateAPIKey)
+		protected.GET("/keys", controllers.ListAPIKeys)
+		protected.DELETE("/keys/:id", controllers.RevokeAPIKey)
+		protected.GET("/identities", controllers.ListIdentities)
+		protected.DELETE("/identities/:provider", controllers.UnlinkIdentity)
+		protected.POST("/oauth/clients", controllers.RegisterClient)
+		protected.GET("/oauth/clients", controllers.ListClients)
+		protected.DELETE("/oauth/clients/:clientId", controllers.DeleteClient)
+		protected.GET("/oauth/requests/:id", controllers.GetAuthorizationRequest)
+		protected.POST("/oauth/requests/:id", controllers.DecideAuthorization)
+		protected.GET("/oauth/apps", controllers.ListAuthorizedApps)
+		protected.DELETE("/oauth/apps/:id", controllers.RevokeSession)
+	}
+
+	admin := r.Group("/api/admin")
+	admin.Use(middleware.AuthMiddleware(), middleware.RequireRole(token.RoleAdmin))
+	{
+		admin.GET("/users/:id/roles", controllers.GetUserRoles)
+		admin.PUT("/users/:id/roles/:role", controllers.GrantRole)
+		admin.DELETE("/users/:id/roles/:role", controllers.RevokeRole)
+		admin.PUT("/users/:id/status", controllers.SetUserStatus)
+		admin.DELETE("/users/:id/status", controllers.ClearUserStatus)
+		admin.GET("/security/events", controllers.AdminListSecurityEvents)
 	}
 
 	// --- Run server ---
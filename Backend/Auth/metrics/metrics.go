@@ -1,33 +1,21 @@
 package metrics
 
 import (
-	"strconv"
-	"time"
-
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	pkgmetrics "rysto/pkg/metrics"
 )
 
+var httpMetrics = pkgmetrics.NewHTTPMetrics("")
+
 var (
 	// Tracks total HTTP requests with labels for endpoint + status
-	HttpRequests = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests processed, labeled by endpoint and status",
-		},
-		[]string{"endpoint", "status"},
-	)
+	HttpRequests = httpMetrics.Requests
 
 	// Tracks request duration (latency) for each endpoint
-	HttpRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "Duration of HTTP requests in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"endpoint"},
-	)
+	HttpRequestDuration = httpMetrics.Duration
 
 	// Count of successful logins
 	SuccessfulLogins = promauto.NewCounter(
@@ -45,37 +33,186 @@ var (
 		},
 	)
 
-	// Gauge for active sessions (increased on login, decreased on logout)
-	ActiveSessions = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "active_sessions",
-			Help: "Number of currently active sessions",
+	// Count of lockouts, labeled by what was locked (email or ip)
+	AccountLockouts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "account_lockouts_total",
+			Help: "Total number of login lockouts, labeled by scope",
 		},
+		[]string{"scope"},
 	)
-)
 
-// 🔹 Prometheus Middleware for Gin
-func PrometheusMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		start := time.Now()
+	// Count of login attempts refused with 429, labeled by reason (delay or lockout)
+	LoginsThrottled = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "logins_throttled_total",
+			Help: "Total number of login attempts refused by the rate limiter",
+		},
+		[]string{"reason"},
+	)
+
+	// Count of role grants and revocations made by admins
+	RoleChanges = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "role_changes_total",
+			Help: "Total number of role changes, labeled by action and role",
+		},
+		[]string{"action", "role"},
+	)
+
+	// Count of suspensions, bans and reinstatements made by admins
+	AccountRestrictions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "account_restrictions_total",
+			Help: "Total number of account suspensions, bans and reinstatements, labeled by action",
+		},
+		[]string{"action"},
+	)
+
+	// Count of email addresses confirmed through /verify
+	EmailsVerified = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "emails_verified_total",
+			Help: "Total number of verified email addresses",
+		},
+	)
+
+	// Count of confirmed email address changes
+	EmailChanges = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "email_changes_total",
+			Help: "Total number of confirmed email address changes",
+		},
+	)
+
+	// Count of deleted accounts, labeled by what happened to their content
+	AccountsDeleted = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "accounts_deleted_total",
+			Help: "Total number of deleted accounts, labeled by purge mode",
+		},
+		[]string{"mode"},
+	)
+
+	// Count of sign-ins through external identity providers, labeled by
+	// provider and outcome (existing, linked, created, denied or failed)
+	OIDCLogins = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oidc_logins_total",
+			Help: "Total number of sign-ins through external identity providers",
+		},
+		[]string{"provider", "outcome"},
+	)
+
+	// Count of consent decisions on OAuth authorization requests, labeled by
+	// decision (approved or denied)
+	OAuthAuthorizations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oauth_authorizations_total",
+			Help: "Total number of OAuth consent decisions",
+		},
+		[]string{"decision"},
+	)
 
-		// Process request
-		c.Next()
+	// Count of access tokens issued to OAuth clients, labeled by grant type
+	OAuthTokensIssued = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oauth_tokens_issued_total",
+			Help: "Total number of access tokens issued to OAuth clients",
+		},
+		[]string{"grant_type"},
+	)
+
+	// Count of introspections by other services, labeled by the verdict
+	// (active, expired, revoked or invalid)
+	Introspections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "token_introspections_total",
+			Help: "Total number of token introspections, labeled by status",
+		},
+		[]string{"status"},
+	)
+
+	// Count of API key changes, labeled by action (created or revoked)
+	APIKeyChanges = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_key_changes_total",
+			Help: "Total number of API keys created or revoked",
+		},
+		[]string{"action"},
+	)
+
+	// Count of data exports started
+	ExportsRequested = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "exports_requested_total",
+			Help: "Total number of personal data exports started",
+		},
+	)
+
+	// Count of password changes, labeled by how they happened (reset or change)
+	PasswordChanges = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "password_changes_total",
+			Help: "Total number of password changes, labeled by method",
+		},
+		[]string{"method"},
+	)
+
+	// Count of invite codes created
+	InvitesCreated = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "invites_created_total",
+			Help: "Total number of invite codes created",
+		},
+	)
 
-		// Endpoint path (route)
-		endpoint := c.FullPath()
-		if endpoint == "" {
-			endpoint = "unknown"
-		}
+	// Count of sign-in links mailed through /login/magic
+	MagicLinksSent = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "magic_links_sent_total",
+			Help: "Total number of passwordless sign-in links sent",
+		},
+	)
 
-		// Status code
-		status := strconv.Itoa(c.Writer.Status())
+	// Count of stored password hashes upgraded to the current policy at login
+	PasswordRehashes = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "password_rehashes_total",
+			Help: "Total number of password hashes upgraded on login",
+		},
+	)
 
-		// Record request count
-		HttpRequests.WithLabelValues(endpoint, status).Inc()
+	// Count of access tokens renewed through /refresh
+	TokenRefreshes = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "token_refreshes_total",
+			Help: "Total number of successful refresh token rotations",
+		},
+	)
 
-		// Record request duration
-		duration := time.Since(start).Seconds()
-		HttpRequestDuration.WithLabelValues(endpoint).Observe(duration)
-	}
+	// Count of replayed refresh tokens (each one revokes the session)
+	RefreshTokenReuse = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "refresh_token_reuse_total",
+			Help: "Total number of refresh token reuse detections",
+		},
+	)
+)
+
+// RegisterActiveSessions exposes the active_sessions gauge. The value is read
+// from the session index on every scrape, so it stays correct across restarts.
+func RegisterActiveSessions(count func() float64) {
+	promauto.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "active_sessions",
+			Help: "Number of currently active sessions",
+		},
+		count,
+	)
+}
+
+// 🔹 Prometheus Middleware for Gin
+func PrometheusMiddleware() gin.HandlerFunc {
+	return httpMetrics.Middleware()
 }
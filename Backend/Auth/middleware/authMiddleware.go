@@ -1,53 +1,43 @@
 package middleware
 
 import (
-	"log"
-	"net/http"
-	
+	"context"
+	"errors"
 
-	"authService.com/auth/redis"
-	"authService.com/auth/utils"
 	"github.com/gin-gonic/gin"
+
+	"authService.com/auth/sessions"
+	"authService.com/auth/utils"
+
+	pkgmiddleware "rysto/pkg/middleware"
+	"rysto/pkg/redis"
+	"rysto/pkg/token"
 )
 
-// AuthMiddleware validates the JWT and checks Redis for token validity
+var errRestrictedToken = errors.New("scoped tokens cannot manage accounts")
+
+// AuthMiddleware validates the JWT, checks Redis for token validity and
+// records activity on the caller's session. API keys and tokens issued to
+// OAuth clients are refused: managing an account, including its keys and
+// apps, always takes a signed-in session.
 func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
-			return
-		}
+	active := pkgmiddleware.RedisTokenCheck(redis.Client)
 
-		token := utils.ExtractToken(authHeader)
-		if token == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization format must be Bearer {token}"})
-			c.Abort()
-			return
+	return pkgmiddleware.Auth(utils.Validator(), func(ctx context.Context, raw string, claims *token.Claims) error {
+		if claims.ClientID != "" || claims.Scope != "" {
+			return errRestrictedToken
 		}
-
-		log.Printf("AuthMiddleware: token extracted: %s", token)
-
-		// Validate JWT token
-		claims, err := utils.ValidateToken(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
-			return
+		if err := active(ctx, raw, claims); err != nil {
+			return err
 		}
-
-		// Check Redis to ensure token is active
-		exists, err := redis.Client.Exists(redis.Ctx, token).Result()
-		if err != nil || exists == 0 {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token is no longer valid"})
-			c.Abort()
-			return
+		if claims.SessionID != "" {
+			_ = sessions.Touch(claims.SessionID)
 		}
+		return nil
+	})
+}
 
-		// Token is valid and present in Redis
-		c.Set("email", claims.Email)
-		c.Set("token", token)
-		c.Next()
-	}
+// RequireRole restricts a route to callers holding one of roles.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return pkgmiddleware.RequireRole(roles...)
 }
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Client is a third-party app registered to act for Rysto users through
+// OAuth 2.0. Confidential clients authenticate with a secret, of which only
+// the SHA-256 digest is stored; public clients (mobile and browser apps)
+// have none and rely on PKCE alone.
+type Client struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	ClientID     string             `bson:"clientId" json:"clientId"`
+	SecretHash   string             `bson:"secretHash,omitempty" json:"-"`
+	Name         string             `bson:"name" json:"name"`
+	RedirectURIs []string           `bson:"redirectUris" json:"redirectUris"`
+	Scopes       []string           `bson:"scopes" json:"scopes"`
+	Confidential bool               `bson:"confidential" json:"confidential"`
+	OwnerID      string             `bson:"ownerId" json:"ownerId"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// AllowsRedirect reports whether uri is one of the client's registered
+// redirect URIs. Matching is exact.
+func (c *Client) AllowsRedirect(uri string) bool {
+	for _, r := range c.RedirectURIs {
+		if r == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScope reports whether the client was registered for scope.
+func (c *Client) AllowsScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidRedirectURI reports whether uri may be registered: an absolute https
+// URL, or http on a loopback host for local development, without a fragment.
+func ValidRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" || u.User != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return false
+}
+
+// EnsureClientIndexes makes client IDs unique and lists owners' clients fast.
+func EnsureClientIndexes(ctx context.Context, clients *mongo.Collection) error {
+	_, err := clients.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "clientId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "ownerId", Value: 1}},
+		},
+	})
+	return err
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Identity links an account to a user at an external OpenID Connect
+// provider. Provider and Subject together identify that user for good; the
+// email is kept for display only.
+type Identity struct {
+	Provider string    `bson:"provider" json:"provider"`
+	Subject  string    `bson:"subject" json:"-"`
+	Email    string    `bson:"email" json:"email"`
+	LinkedAt time.Time `bson:"linkedAt" json:"linkedAt"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Invite is a code that lets up to MaxUses people register until ExpiresAt.
+// Accounts created with it record CreatedBy as their inviter.
+type Invite struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Code      string             `bson:"code" json:"code"`
+	CreatedBy string             `bson:"createdBy" json:"createdBy"`
+	MaxUses   int                `bson:"maxUses" json:"maxUses"`
+	Uses      int                `bson:"uses" json:"uses"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// EnsureInviteIndexes makes codes unique and lists a user's invites fast.
+func EnsureInviteIndexes(ctx context.Context, invites *mongo.Collection) error {
+	_, err := invites.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "createdBy", Value: 1}},
+		},
+	})
+	return err
+}
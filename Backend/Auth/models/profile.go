@@ -0,0 +1,149 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PublicProfile is what anyone can see about an account. It never includes
+// the email address.
+type PublicProfile struct {
+	ID          string    `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"displayName,omitempty"`
+	Bio         string    `json:"bio,omitempty"`
+	AvatarURL   string    `json:"avatarUrl,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Public returns the public view of u.
+func (u *User) Public() PublicProfile {
+	return PublicProfile{
+		ID:          u.ID.Hex(),
+		Handle:      u.Handle,
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		AvatarURL:   u.AvatarURL,
+		CreatedAt:   u.CreatedAt,
+	}
+}
+
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// NormalizeHandle lowercases a handle and strips a leading "@".
+func NormalizeHandle(handle string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+}
+
+// ValidHandle reports whether a normalized handle is 3-30 characters of
+// lowercase letters, digits and underscores.
+func ValidHandle(handle string) bool {
+	return handlePattern.MatchString(handle)
+}
+
+// DeriveHandle builds a handle from the local part of an email address. The
+// first attempt uses it as is; later attempts append a random suffix to get
+// past handles that are already taken.
+func DeriveHandle(email string, attempt int) string {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+
+	var b strings.Builder
+	for _, r := range local {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			b.WriteRune(r)
+		case r == '.' || r == '-' || r == '+':
+			b.WriteRune('_')
+		}
+	}
+
+	handle := b.String()
+	if len(handle) > 24 {
+		handle = handle[:24]
+	}
+	for len(handle) < 3 {
+		handle += "_"
+	}
+	if attempt > 0 {
+		handle = fmt.Sprintf("%s_%04d", handle, rand.IntN(10000))
+	}
+	return handle
+}
+
+// EnsureIndexes creates the unique indexes on email addresses, handles and
+// linked external identities. Accounts without a handle or identity are left
+// out of the latter two.
+func EnsureIndexes(ctx context.Context, users *mongo.Collection) error {
+	_, err := users.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName(emailIndex),
+		},
+		{
+			Keys: bson.D{{Key: "handle", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"handle": bson.M{"$type": "string"}}),
+		},
+		{
+			Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"identities.subject": bson.M{"$type": "string"}}),
+		},
+		{
+			Keys:    bson.D{{Key: "invitedBy", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	return err
+}
+
+const emailIndex = "email_unique"
+
+// DuplicateEmail reports whether err is a write refused because another
+// account already uses the email address.
+func DuplicateEmail(err error) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "index: "+emailIndex+" ")
+}
+
+// BackfillProfiles gives accounts created before profiles existed a handle
+// derived from their email and a creation date taken from their ObjectID.
+func BackfillProfiles(ctx context.Context, users *mongo.Collection) (int64, error) {
+	cursor, err := users.Find(ctx, bson.M{"handle": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var n int64
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil {
+			return n, err
+		}
+
+		for attempt := 0; ; attempt++ {
+			_, err = users.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+				"handle":    DeriveHandle(user.Email, attempt),
+				"createdAt": user.ID.Timestamp(),
+			}})
+			if !mongo.IsDuplicateKeyError(err) || attempt >= 10 {
+				break
+			}
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, cursor.Err()
+}
@@ -1,10 +1,122 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"rysto/pkg/token"
+	"rysto/pkg/userstatus"
+)
 
 // User represents the structure of a user document in MongoDB.
 type User struct {
-    ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-    Email    string             `bson:"email" json:"email" binding:"required,email"`
-    Password string             `bson:"password" json:"-" binding:"required,min=6"` // `json:"-"` hides it from JSON output
+    ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Email      string             `bson:"email" json:"email" binding:"required,email"`
+    Password   string             `bson:"password" json:"-" binding:"required,min=6"` // `json:"-"` hides it from JSON output
+    Verified   bool               `bson:"verified" json:"verified"`
+    VerifiedAt *time.Time         `bson:"verifiedAt,omitempty" json:"verifiedAt,omitempty"`
+    Roles      []string           `bson:"roles" json:"roles"`
+
+    // The user whose invite code this account registered with, if any.
+    InvitedBy string `bson:"invitedBy,omitempty" json:"invitedBy,omitempty"`
+
+    // Public profile
+    Handle      string    `bson:"handle,omitempty" json:"handle"`
+    DisplayName string    `bson:"displayName,omitempty" json:"displayName,omitempty"`
+    Bio         string    `bson:"bio,omitempty" json:"bio,omitempty"`
+    AvatarURL   string    `bson:"avatarUrl,omitempty" json:"avatarUrl,omitempty"`
+    CreatedAt   time.Time `bson:"createdAt" json:"createdAt"`
+
+    // Two-factor authentication. Secrets are AES-GCM encrypted, recovery
+    // codes are stored as SHA-256 digests.
+    TOTPEnabled       bool     `bson:"totpEnabled" json:"totpEnabled"`
+    TOTPSecret        string   `bson:"totpSecret,omitempty" json:"-"`
+    TOTPPendingSecret string   `bson:"totpPendingSecret,omitempty" json:"-"`
+    RecoveryCodes     []string `bson:"recoveryCodes,omitempty" json:"-"`
+
+    // Moderation. Status is empty for accounts in good standing; a
+    // suspension lapses by itself once StatusUntil has passed.
+    Status       string     `bson:"status,omitempty" json:"status,omitempty"`
+    StatusReason string     `bson:"statusReason,omitempty" json:"statusReason,omitempty"`
+    StatusUntil  *time.Time `bson:"statusUntil,omitempty" json:"statusUntil,omitempty"`
+
+    // Accounts at external identity providers linked to this one. An account
+    // created through one of them has no password until it sets one.
+    Identities []Identity `bson:"identities,omitempty" json:"-"`
+}
+
+// Restriction returns the suspension or ban in force on the account at now,
+// or nil when there is none.
+func (u *User) Restriction(now time.Time) *userstatus.Status {
+	switch u.Status {
+	case userstatus.Banned:
+		return &userstatus.Status{State: u.Status, Reason: u.StatusReason}
+	case userstatus.Suspended:
+		if u.StatusUntil != nil && now.Before(*u.StatusUntil) {
+			return &userstatus.Status{State: u.Status, Reason: u.StatusReason, Until: *u.StatusUntil}
+		}
+	}
+	return nil
+}
+
+// RestrictedUsers returns the accounts that are banned or whose suspension
+// has not lapsed yet.
+func RestrictedUsers(ctx context.Context, users *mongo.Collection) ([]User, error) {
+	cursor, err := users.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"status": userstatus.Banned},
+		bson.M{"status": userstatus.Suspended, "statusUntil": bson.M{"$gt": time.Now()}},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	var list []User
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// BackfillVerified marks accounts created before email verification existed
+// as verified, so they keep their ability to write and vote.
+func BackfillVerified(ctx context.Context, users *mongo.Collection) (int64, error) {
+	res, err := users.UpdateMany(ctx,
+		bson.M{"verified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"verified": true}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// BackfillRoles gives accounts created before roles existed the user role.
+func BackfillRoles(ctx context.Context, users *mongo.Collection) (int64, error) {
+	res, err := users.UpdateMany(ctx,
+		bson.M{"roles": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"roles": []string{token.RoleUser}}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// BootstrapAdmins grants the admin role to the given accounts, so a fresh
+// deployment has someone who can hand out roles through the API.
+func BootstrapAdmins(ctx context.Context, users *mongo.Collection, emails []string) (int64, error) {
+	if len(emails) == 0 {
+		return 0, nil
+	}
+	res, err := users.UpdateMany(ctx,
+		bson.M{"email": bson.M{"$in": emails}},
+		bson.M{"$addToSet": bson.M{"roles": token.RoleAdmin}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
 }
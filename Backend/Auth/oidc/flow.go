@@ -0,0 +1,211 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	goredis "github.com/redis/go-redis/v9"
+
+	"authService.com/auth/utils"
+
+	"rysto/pkg/redis"
+)
+
+// StateTTL bounds how long a user may take at the provider.
+const StateTTL = 10 * time.Minute
+
+var (
+	ErrInvalidState = errors.New("invalid or expired login state")
+	ErrInvalidToken = errors.New("invalid id token")
+)
+
+// Identity is what the provider asserted about the user.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// Redis layout:
+//
+//	oidc_state:<state>  string JSON {provider, verifier, nonce}, deleted on use
+func stateKey(state string) string { return "oidc_state:" + state }
+
+type loginState struct {
+	Provider string `json:"provider"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+}
+
+// Begin starts a login at the provider and returns the URL to send the user
+// to. The state, nonce and PKCE verifier stay in Redis until the callback.
+func (p *Provider) Begin(ctx context.Context) (string, error) {
+	d, _, err := p.endpoints(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := utils.GenerateOpaqueToken(24)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.GenerateOpaqueToken(24)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := utils.GenerateOpaqueToken(48)
+	if err != nil {
+		return "", err
+	}
+
+	data, _ := json.Marshal(loginState{Provider: p.ID, Verifier: verifier, Nonce: nonce})
+	if err := redis.Client.Set(redis.Ctx, stateKey(state), data, StateTTL).Err(); err != nil {
+		return "", err
+	}
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {utils.PKCEChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Finish completes a login from the callback parameters: it consumes the
+// state, redeems the code and verifies the ID token.
+func (p *Provider) Finish(ctx context.Context, state, code string) (*Identity, error) {
+	data, err := redis.Client.GetDel(redis.Ctx, stateKey(state)).Result()
+	if err == goredis.Nil {
+		return nil, ErrInvalidState
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ls loginState
+	if err := json.Unmarshal([]byte(data), &ls); err != nil || ls.Provider != p.ID {
+		return nil, ErrInvalidState
+	}
+	return p.redeem(ctx, code, ls.Verifier, ls.Nonce)
+}
+
+// redeem exchanges code for an ID token and verifies it.
+func (p *Provider) redeem(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	d, keys, err := p.endpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, err := p.exchange(ctx, d.TokenEndpoint, code, verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &idTokenClaims{}
+	parsed, err := jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodEd25519:
+		default:
+			return nil, jwt.ErrSignatureInvalid
+		}
+		kid, _ := t.Header["kid"].(string)
+		return keys.Key(kid)
+	})
+	if err != nil || !parsed.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if !claims.VerifyIssuer(p.Issuer, true) || !claims.VerifyAudience(p.ClientID, true) {
+		return nil, fmt.Errorf("%w: wrong issuer or audience", ErrInvalidToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+
+	return &Identity{
+		Provider:      p.ID,
+		Subject:       claims.Subject,
+		Email:         strings.ToLower(claims.Email),
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+	}, nil
+}
+
+type idTokenClaims struct {
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+	Picture       string   `json:"picture"`
+	jwt.RegisteredClaims
+}
+
+// flexBool accepts both true and "true"; some providers send email_verified
+// as a string.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	*b = flexBool(s == "true")
+	return nil
+}
+
+// exchange redeems code at the token endpoint and returns the ID token.
+func (p *Provider) exchange(ctx context.Context, endpoint, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("%s token endpoint: %v", p.ID, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return "", fmt.Errorf("%s token endpoint: status %d %s", p.ID, resp.StatusCode, body.Error)
+	}
+	return body.IDToken, nil
+}
@@ -0,0 +1,152 @@
+// Package oidc signs users in through external OpenID Connect providers with
+// the authorization code flow and PKCE.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"rysto/pkg/token"
+)
+
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// Provider is one configured identity provider.
+type Provider struct {
+	ID           string
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RedirectURL  string
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      *token.JWKS
+}
+
+// discovery holds the parts of the provider's
+// /.well-known/openid-configuration that the login flow needs.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+var (
+	providers  = map[string]*Provider{}
+	httpClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// SetProviders replaces the configured providers.
+func SetProviders(list []*Provider) {
+	providers = make(map[string]*Provider, len(list))
+	for _, p := range list {
+		providers[p.ID] = p
+	}
+}
+
+// Get returns the provider with the given ID.
+func Get(id string) (*Provider, error) {
+	p, ok := providers[id]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// List returns the configured providers ordered by ID.
+func List() []*Provider {
+	list := make([]*Provider, 0, len(providers))
+	for _, p := range providers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// ProvidersFromEnv reads OIDC_PROVIDERS, a comma-separated list of provider
+// IDs, and for each ID the variables OIDC_<ID>_ISSUER, OIDC_<ID>_CLIENT_ID,
+// OIDC_<ID>_CLIENT_SECRET and optionally OIDC_<ID>_NAME and
+// OIDC_<ID>_SCOPES. Callbacks go to <publicURL>/oauth/<id>/callback, which
+// has to be registered with the provider.
+func ProvidersFromEnv(publicURL string) ([]*Provider, error) {
+	var list []*Provider
+	for _, id := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(id) + "_"
+
+		p := &Provider{
+			ID:           id,
+			Name:         os.Getenv(prefix + "NAME"),
+			Issuer:       strings.TrimRight(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+			RedirectURL:  strings.TrimRight(publicURL, "/") + "/oauth/" + id + "/callback",
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+		if p.Name == "" {
+			p.Name = id
+		}
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{"openid", "email", "profile"}
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+// endpoints fetches the provider's discovery document on first use and keeps
+// it for the life of the process.
+func (p *Provider) endpoints(ctx context.Context) (*discovery, *token.JWKS, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, p.keys, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("%s discovery: unexpected status %d", p.ID, resp.StatusCode)
+	}
+
+	var d discovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, nil, err
+	}
+	if strings.TrimRight(d.Issuer, "/") != p.Issuer {
+		return nil, nil, fmt.Errorf("%s discovery: issuer %q does not match %q", p.ID, d.Issuer, p.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, nil, fmt.Errorf("%s discovery: incomplete document", p.ID)
+	}
+
+	p.discovery = &d
+	p.keys = token.NewJWKS(d.JWKSURI, time.Hour)
+	return p.discovery, p.keys, nil
+}
@@ -0,0 +1,54 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// breached holds the SHA-1 digests of passwords known from data breaches.
+var breached = map[[sha1.Size]byte]struct{}{}
+
+// LoadBreached reads a list of breached passwords from path and returns how
+// many it holds. Each line is an uppercase or lowercase hex SHA-1 digest,
+// optionally followed by ":count" as in the Pwned Passwords downloads;
+// blank lines and lines starting with # are skipped.
+func LoadBreached(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	set := map[[sha1.Size]byte]struct{}{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		digest, _, _ := strings.Cut(line, ":")
+		var sum [sha1.Size]byte
+		if len(digest) != 2*sha1.Size {
+			continue
+		}
+		if _, err := hex.Decode(sum[:], []byte(digest)); err != nil {
+			continue
+		}
+		set[sum] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	breached = set
+	return len(set), nil
+}
+
+// Breached reports whether password is on the loaded breach list.
+func Breached(password string) bool {
+	_, ok := breached[sha1.Sum([]byte(password))]
+	return ok
+}
@@ -0,0 +1,132 @@
+// Package passwords hashes and verifies account passwords. Hashes carry
+// their algorithm and parameters in the encoded string (bcrypt's "$2b$10$..."
+// or the PHC string "$argon2id$v=19$m=...,t=...,p=...$salt$hash"), so hashes
+// made under an older policy keep verifying and can be recognised as weaker
+// than the current one and replaced at the next login.
+package passwords
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hasher produces password hashes under one policy.
+type Hasher interface {
+	// Hash returns the encoded hash of password.
+	Hash(password string) (string, error)
+	// Upgrades reports whether encoded is weaker than what Hash produces and
+	// should be replaced. A hasher never asks to downgrade a stronger hash.
+	Upgrades(encoded string) bool
+}
+
+var ErrUnknownFormat = errors.New("unrecognised password hash format")
+
+var policy Hasher = DefaultArgon2id
+
+// SetPolicy sets the hasher new passwords are hashed with.
+func SetPolicy(h Hasher) {
+	policy = h
+}
+
+// Hash hashes password under the current policy.
+func Hash(password string) (string, error) {
+	return policy.Hash(password)
+}
+
+// Verify reports whether password matches encoded, whatever algorithm and
+// parameters encoded was made with.
+func Verify(encoded, password string) bool {
+	switch {
+	case isArgon2id(encoded):
+		ok, err := verifyArgon2id(encoded, password)
+		return err == nil && ok
+	case isBcrypt(encoded):
+		return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+	}
+	return false
+}
+
+// NeedsRehash reports whether encoded is weaker than the current policy.
+func NeedsRehash(encoded string) bool {
+	return policy.Upgrades(encoded)
+}
+
+// Bcrypt hashes with bcrypt at Cost. It is kept for deployments that cannot
+// spare Argon2id's memory.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	return string(hashed), err
+}
+
+// Upgrades asks for bcrypt hashes of a lower cost to be replaced.
+func (b Bcrypt) Upgrades(encoded string) bool {
+	if !isBcrypt(encoded) {
+		return false
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err == nil && cost < b.Cost
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// FromEnv builds the hashing policy from PASSWORD_HASH ("argon2id", the
+// default, or "bcrypt") and the parameters of that algorithm:
+// ARGON2_MEMORY (KiB), ARGON2_ITERATIONS and ARGON2_PARALLELISM, or
+// BCRYPT_COST. Unset parameters keep their defaults.
+func FromEnv() (Hasher, error) {
+	switch alg := strings.ToLower(os.Getenv("PASSWORD_HASH")); alg {
+	case "", "argon2id":
+		a := DefaultArgon2id
+		if err := envUint("ARGON2_MEMORY", &a.Memory, 8*1024); err != nil {
+			return nil, err
+		}
+		if err := envUint("ARGON2_ITERATIONS", &a.Iterations, 1); err != nil {
+			return nil, err
+		}
+		p := uint32(a.Parallelism)
+		if err := envUint("ARGON2_PARALLELISM", &p, 1); err != nil {
+			return nil, err
+		}
+		if p > 255 {
+			return nil, fmt.Errorf("invalid ARGON2_PARALLELISM %d", p)
+		}
+		a.Parallelism = uint8(p)
+		return a, nil
+	case "bcrypt":
+		b := Bcrypt{Cost: bcrypt.DefaultCost}
+		if v := os.Getenv("BCRYPT_COST"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < bcrypt.MinCost || n > bcrypt.MaxCost {
+				return nil, fmt.Errorf("invalid BCRYPT_COST %q", v)
+			}
+			b.Cost = n
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unknown PASSWORD_HASH %q", alg)
+	}
+}
+
+func envUint(name string, dst *uint32, min uint32) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil || uint32(n) < min {
+		return fmt.Errorf("invalid %s %q", name, v)
+	}
+	*dst = uint32(n)
+	return nil
+}
@@ -0,0 +1,83 @@
+package passwords
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Small parameters keep the tests fast; only their order matters.
+var (
+	argonPolicy   = Argon2id{Memory: 2048, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	argonLessMem  = Argon2id{Memory: 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	argonFewer    = Argon2id{Memory: 2048, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	argonShortKey = Argon2id{Memory: 2048, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 16}
+	argonStronger = Argon2id{Memory: 4096, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+	bcryptPolicy  = Bcrypt{Cost: bcrypt.MinCost + 1}
+	bcryptLower   = Bcrypt{Cost: bcrypt.MinCost}
+	bcryptHigher  = Bcrypt{Cost: bcrypt.MinCost + 2}
+)
+
+const password = "correct horse battery staple"
+
+func mustHash(t *testing.T, h Hasher) string {
+	t.Helper()
+	encoded, err := h.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestNeedsRehash(t *testing.T) {
+	t.Cleanup(func() { SetPolicy(DefaultArgon2id) })
+
+	tests := []struct {
+		name    string
+		policy  Hasher
+		made    Hasher // nil: use encoded
+		encoded string
+		want    bool
+	}{
+		{name: "argon2id: same parameters", policy: argonPolicy, made: argonPolicy},
+		{name: "argon2id: stronger hash kept", policy: argonPolicy, made: argonStronger},
+		{name: "argon2id: less memory", policy: argonPolicy, made: argonLessMem, want: true},
+		{name: "argon2id: fewer passes", policy: argonPolicy, made: argonFewer, want: true},
+		{name: "argon2id: shorter key", policy: argonPolicy, made: argonShortKey, want: true},
+		{name: "argon2id: bcrypt hash", policy: argonPolicy, made: bcryptHigher, want: true},
+		{name: "argon2id: malformed hash", policy: argonPolicy, encoded: "$argon2id$v=19$m=2048$salt", want: true},
+		{name: "argon2id: unknown format", policy: argonPolicy, encoded: "plaintext", want: true},
+		{name: "bcrypt: same cost", policy: bcryptPolicy, made: bcryptPolicy},
+		{name: "bcrypt: higher cost kept", policy: bcryptPolicy, made: bcryptHigher},
+		{name: "bcrypt: lower cost", policy: bcryptPolicy, made: bcryptLower, want: true},
+		{name: "bcrypt: argon2id hash kept", policy: bcryptPolicy, made: argonLessMem},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := tt.encoded
+			if tt.made != nil {
+				encoded = mustHash(t, tt.made)
+			}
+			SetPolicy(tt.policy)
+			if got := NeedsRehash(encoded); got != tt.want {
+				t.Errorf("NeedsRehash(%q) = %v, want %v", encoded, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	for _, h := range []Hasher{argonPolicy, argonShortKey, argonStronger, bcryptLower, bcryptPolicy} {
+		encoded := mustHash(t, h)
+		if !Verify(encoded, password) {
+			t.Errorf("Verify(%q) rejected the right password", encoded)
+		}
+		if Verify(encoded, password+"!") {
+			t.Errorf("Verify(%q) accepted a wrong password", encoded)
+		}
+	}
+	if Verify("plaintext", "plaintext") {
+		t.Error("Verify accepted an unknown hash format")
+	}
+}
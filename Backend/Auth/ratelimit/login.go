@@ -0,0 +1,202 @@
+// Package ratelimit slows down password guessing against /login. Failures are
+// tracked in Redis sliding windows per client IP and per email address:
+// after a few failures each further attempt has to wait progressively longer,
+// and after too many the email (or IP) is locked out for a while.
+package ratelimit
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"rysto/pkg/redis"
+)
+
+// Config tunes the limits. ConfigFromEnv overrides some of the defaults in cfg.
+type Config struct {
+	Window          time.Duration // sliding window failures are counted in
+	DelayAfter      int           // failures before progressive delays start
+	BaseDelay       time.Duration // first delay, doubled for every further failure
+	MaxDelay        time.Duration
+	EmailLockout    int // failures per email that lock the account
+	IPLockout       int // failures per IP that block the client
+	LockoutDuration time.Duration
+}
+
+var cfg = Config{
+	Window:          15 * time.Minute,
+	DelayAfter:      3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	EmailLockout:    10,
+	IPLockout:       50,
+	LockoutDuration: 15 * time.Minute,
+}
+
+// ConfigFromEnv applies LOGIN_LOCKOUT_THRESHOLD, LOGIN_IP_LIMIT and
+// LOGIN_LOCKOUT_DURATION when set.
+func ConfigFromEnv() error {
+	if v := os.Getenv("LOGIN_LOCKOUT_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid LOGIN_LOCKOUT_THRESHOLD %q", v)
+		}
+		cfg.EmailLockout = n
+	}
+	if v := os.Getenv("LOGIN_IP_LIMIT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid LOGIN_IP_LIMIT %q", v)
+		}
+		cfg.IPLockout = n
+	}
+	if v := os.Getenv("LOGIN_LOCKOUT_DURATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid LOGIN_LOCKOUT_DURATION %q", v)
+		}
+		cfg.LockoutDuration = d
+	}
+	return nil
+}
+
+// LockoutDuration returns how long a lockout lasts.
+func LockoutDuration() time.Duration {
+	return cfg.LockoutDuration
+}
+
+// Scopes a failure is counted under.
+const (
+	ScopeEmail = "email"
+	ScopeIP    = "ip"
+)
+
+// Block explains why an attempt is refused and when to retry.
+type Block struct {
+	Scope      string
+	Locked     bool // true for a lockout, false for a progressive delay
+	RetryAfter time.Duration
+}
+
+// Redis layout:
+//
+//	login_fail:<scope>:<key>  sorted set of failure timestamps (unix nanos)
+//	login_wait:<scope>:<key>  string, present while the progressive delay runs
+//	login_lock:<scope>:<key>  string, present while locked out
+func failKey(scope, key string) string { return "login_fail:" + scope + ":" + key }
+func waitKey(scope, key string) string { return "login_wait:" + scope + ":" + key }
+func lockKey(scope, key string) string { return "login_lock:" + scope + ":" + key }
+
+func normalize(email string) string { return strings.ToLower(strings.TrimSpace(email)) }
+
+// Check returns a non-nil Block when an attempt for ip and email must be
+// refused right now.
+func Check(ip, email string) (*Block, error) {
+	subjects := [][2]string{{ScopeIP, ip}, {ScopeEmail, normalize(email)}}
+
+	for _, s := range subjects {
+		ttl, err := redis.Client.PTTL(redis.Ctx, lockKey(s[0], s[1])).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ttl > 0 {
+			return &Block{Scope: s[0], Locked: true, RetryAfter: ttl}, nil
+		}
+	}
+	for _, s := range subjects {
+		ttl, err := redis.Client.PTTL(redis.Ctx, waitKey(s[0], s[1])).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ttl > 0 {
+			return &Block{Scope: s[0], RetryAfter: ttl}, nil
+		}
+	}
+	return nil, nil
+}
+
+// RecordFailure counts a failed attempt and returns the scopes that were
+// locked out by it.
+func RecordFailure(ip, email string) ([]string, error) {
+	var locked []string
+
+	for _, s := range [][2]string{{ScopeIP, ip}, {ScopeEmail, normalize(email)}} {
+		scope, key := s[0], s[1]
+		count, err := recordFailure(scope, key)
+		if err != nil {
+			return locked, err
+		}
+
+		threshold := cfg.EmailLockout
+		if scope == ScopeIP {
+			threshold = cfg.IPLockout
+		}
+
+		if count >= int64(threshold) {
+			set, err := redis.Client.SetNX(redis.Ctx, lockKey(scope, key), 1, cfg.LockoutDuration).Result()
+			if err != nil {
+				return locked, err
+			}
+			if set {
+				locked = append(locked, scope)
+			}
+			continue
+		}
+
+		// The per-IP delay would let one attacker throttle a whole NAT, so
+		// delays only apply per email; the IP is limited by its lockout.
+		if scope == ScopeEmail && count > int64(cfg.DelayAfter) {
+			if err := redis.Client.Set(redis.Ctx, waitKey(scope, key), 1, delayFor(count)).Err(); err != nil {
+				return locked, err
+			}
+		}
+	}
+	return locked, nil
+}
+
+func recordFailure(scope, key string) (int64, error) {
+	now := time.Now()
+	fk := failKey(scope, key)
+
+	pipe := redis.Client.TxPipeline()
+	pipe.ZRemRangeByScore(redis.Ctx, fk, "-inf", strconv.FormatInt(now.Add(-cfg.Window).UnixNano(), 10))
+	pipe.ZAdd(redis.Ctx, fk, goredis.Z{Score: float64(now.UnixNano()), Member: now.UnixNano()})
+	count := pipe.ZCard(redis.Ctx, fk)
+	pipe.Expire(redis.Ctx, fk, cfg.Window)
+	if _, err := pipe.Exec(redis.Ctx); err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+// delayFor doubles the wait for every failure past DelayAfter.
+func delayFor(failures int64) time.Duration {
+	delay := cfg.BaseDelay
+	for i := int64(cfg.DelayAfter) + 1; i < failures && delay < cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > cfg.MaxDelay {
+		delay = cfg.MaxDelay
+	}
+	return delay
+}
+
+// Reset forgets the failures of email after a successful login.
+func Reset(email string) error {
+	email = normalize(email)
+	return redis.Client.Del(redis.Ctx, failKey(ScopeEmail, email), waitKey(ScopeEmail, email)).Err()
+}
+
+// Unlock lifts a lockout of email and forgets its failures.
+func Unlock(email string) error {
+	email = normalize(email)
+	return redis.Client.Del(redis.Ctx,
+		lockKey(ScopeEmail, email),
+		failKey(ScopeEmail, email),
+		waitKey(ScopeEmail, email),
+	).Err()
+}
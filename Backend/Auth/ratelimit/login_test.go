@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayFor(t *testing.T) {
+	defaults := cfg
+	t.Cleanup(func() { cfg = defaults })
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		failures int64
+		want     time.Duration
+	}{
+		{name: "first delayed failure", cfg: defaults, failures: 4, want: time.Second},
+		{name: "doubles", cfg: defaults, failures: 5, want: 2 * time.Second},
+		{name: "doubles again", cfg: defaults, failures: 7, want: 8 * time.Second},
+		{name: "last before the cap", cfg: defaults, failures: 9, want: 32 * time.Second},
+		{name: "capped", cfg: defaults, failures: 10, want: time.Minute},
+		{name: "stays capped", cfg: defaults, failures: 1000, want: time.Minute},
+		{
+			name:     "custom base and cap",
+			cfg:      Config{DelayAfter: 0, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second},
+			failures: 3,
+			want:     400 * time.Millisecond,
+		},
+		{
+			name:     "base above the cap",
+			cfg:      Config{DelayAfter: 3, BaseDelay: 2 * time.Minute, MaxDelay: time.Minute},
+			failures: 4,
+			want:     time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = tt.cfg
+			if got := delayFor(tt.failures); got != tt.want {
+				t.Errorf("delayFor(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"rysto/pkg/redis"
+)
+
+// Sign-in links an email address may be sent per window, so /login/magic
+// cannot be used to flood someone's inbox.
+const (
+	MagicLinkLimit  = 3
+	MagicLinkWindow = 15 * time.Minute
+)
+
+// Redis layout:
+//
+//	magic_sent:<email>  sorted set of send timestamps (unix nanos)
+func magicKey(email string) string { return "magic_sent:" + email }
+
+// AllowMagicLink counts a sign-in link for email against its limit. When the
+// limit is reached it returns false and how long until the oldest send
+// leaves the window; refused attempts are not counted.
+func AllowMagicLink(email string) (bool, time.Duration, error) {
+	now := time.Now()
+	key := magicKey(normalize(email))
+	member := strconv.FormatInt(now.UnixNano(), 10)
+
+	// Counting the attempt before checking keeps concurrent requests from
+	// all slipping under the limit.
+	pipe := redis.Client.TxPipeline()
+	pipe.ZRemRangeByScore(redis.Ctx, key, "-inf", strconv.FormatInt(now.Add(-MagicLinkWindow).UnixNano(), 10))
+	pipe.ZAdd(redis.Ctx, key, goredis.Z{Score: float64(now.UnixNano()), Member: member})
+	count := pipe.ZCard(redis.Ctx, key)
+	oldest := pipe.ZRangeWithScores(redis.Ctx, key, 0, 0)
+	pipe.Expire(redis.Ctx, key, MagicLinkWindow)
+	if _, err := pipe.Exec(redis.Ctx); err != nil {
+		return false, 0, err
+	}
+	if count.Val() <= MagicLinkLimit {
+		return true, 0, nil
+	}
+
+	if err := redis.Client.ZRem(redis.Ctx, key, member).Err(); err != nil {
+		return false, 0, err
+	}
+	retry := MagicLinkWindow
+	if z := oldest.Val(); len(z) > 0 {
+		retry = time.Unix(0, int64(z[0].Score)).Add(MagicLinkWindow).Sub(now)
+	}
+	return false, retry, nil
+}
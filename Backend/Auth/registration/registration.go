@@ -0,0 +1,97 @@
+// Package registration decides who may create an account: anyone, only
+// holders of an invite code, or addresses on an allowlist of email domains.
+// An invite code admits its holder in every mode.
+package registration
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Modes.
+const (
+	ModeOpen   = "open"
+	ModeInvite = "invite"
+	ModeDomain = "domain"
+)
+
+// Config is the registration policy.
+type Config struct {
+	Mode        string
+	Domains     []string // lowercase, for ModeDomain
+	UserInvites bool     // whether users other than admins may create invites
+}
+
+var cfg = Config{Mode: ModeOpen, UserInvites: true}
+
+// ConfigFromEnv reads REGISTRATION_MODE, REGISTRATION_DOMAINS (comma
+// separated, required for the domain mode) and REGISTRATION_USER_INVITES.
+func ConfigFromEnv() error {
+	c := Config{Mode: ModeOpen, UserInvites: true}
+
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("REGISTRATION_MODE"))); v != "" {
+		c.Mode = v
+	}
+	switch c.Mode {
+	case ModeOpen, ModeInvite:
+	case ModeDomain:
+		for _, d := range strings.Split(os.Getenv("REGISTRATION_DOMAINS"), ",") {
+			if d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@")); d != "" {
+				c.Domains = append(c.Domains, d)
+			}
+		}
+		if len(c.Domains) == 0 {
+			return fmt.Errorf("REGISTRATION_DOMAINS must be set for REGISTRATION_MODE=domain")
+		}
+	default:
+		return fmt.Errorf("invalid REGISTRATION_MODE %q", c.Mode)
+	}
+
+	if v := os.Getenv("REGISTRATION_USER_INVITES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid REGISTRATION_USER_INVITES %q", v)
+		}
+		c.UserInvites = b
+	}
+
+	cfg = c
+	return nil
+}
+
+// Mode returns the registration mode.
+func Mode() string {
+	return cfg.Mode
+}
+
+// UserInvites reports whether users other than admins may create invites.
+func UserInvites() bool {
+	return cfg.UserInvites
+}
+
+// NeedsInvite reports whether email can only register with an invite code.
+func NeedsInvite(email string) bool {
+	switch cfg.Mode {
+	case ModeInvite:
+		return true
+	case ModeDomain:
+		return !domainAllowed(email)
+	}
+	return false
+}
+
+func domainAllowed(email string) bool {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[i+1:])
+	for _, d := range cfg.Domains {
+		if domain == d {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,319 @@
+package sessions
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"authService.com/auth/utils"
+
+	"rysto/pkg/redis"
+)
+
+// TTL is the idle lifetime of a session. Refreshing the access token pushes
+// the expiry out again, so an active client stays logged in.
+const TTL = 30 * 24 * time.Hour
+
+var ErrNotFound = errors.New("session not found")
+
+// Session is one logged-in device of a user, or one third-party app the user
+// authorized. Its ID doubles as the refresh token family ID.
+type Session struct {
+	ID        string    `json:"id"`
+	UserAgent string    `json:"userAgent"`
+	IP        string    `json:"ip"`
+	Client    string    `json:"client,omitempty"`
+	Scope     string    `json:"scope,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Current   bool      `json:"current"`
+}
+
+// Redis layout:
+//
+//	session:<id>               hash {user, userAgent, ip, client, scope, createdAt, lastSeen, access}
+//	user_sessions:<userId>     set of session IDs
+//	client_sessions:<clientId> set of session IDs of an OAuth client
+//	sessions:active            sorted set of session IDs scored by expiry (unix seconds)
+//	<access token>             string user ID (checked by every service middleware)
+//
+// Sessions of OAuth clients carry the client ID and the granted scope; their
+// tokens are restricted to that scope.
+const activeKey = "sessions:active"
+
+func sessionKey(id string) string      { return "session:" + id }
+func userKey(userID string) string     { return "user_sessions:" + userID }
+func clientKey(clientID string) string { return "client_sessions:" + clientID }
+func expiryScore(t time.Time) float64  { return float64(t.Add(TTL).Unix()) }
+
+// Create registers a new session for the user and returns its ID.
+func Create(userID, userAgent, ip string) (string, error) {
+	return create(userID, "", "", userAgent, ip)
+}
+
+// CreateForClient registers the session behind an OAuth client's tokens,
+// limited to scope, and returns its ID.
+func CreateForClient(userID, clientID, scope, userAgent, ip string) (string, error) {
+	return create(userID, clientID, scope, userAgent, ip)
+}
+
+func create(userID, clientID, scope, userAgent, ip string) (string, error) {
+	id, err := utils.GenerateOpaqueToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+
+	pipe := redis.Client.TxPipeline()
+	pipe.HSet(redis.Ctx, sessionKey(id),
+		"user", userID,
+		"userAgent", userAgent,
+		"ip", ip,
+		"client", clientID,
+		"scope", scope,
+		"createdAt", now.Unix(),
+		"lastSeen", now.Unix(),
+	)
+	pipe.Expire(redis.Ctx, sessionKey(id), TTL)
+	pipe.SAdd(redis.Ctx, userKey(userID), id)
+	pipe.Expire(redis.Ctx, userKey(userID), TTL)
+	if clientID != "" {
+		pipe.SAdd(redis.Ctx, clientKey(clientID), id)
+	}
+	pipe.ZAdd(redis.Ctx, activeKey, goredis.Z{Score: expiryScore(now), Member: id})
+	if _, err := pipe.Exec(redis.Ctx); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// ClientOf returns the OAuth client and scope of a session; both are empty
+// for first-party sessions.
+func ClientOf(id string) (clientID, scope string, err error) {
+	fields, err := redis.Client.HMGet(redis.Ctx, sessionKey(id), "user", "client", "scope").Result()
+	if err != nil {
+		return "", "", err
+	}
+	if fields[0] == nil {
+		return "", "", ErrNotFound
+	}
+	clientID, _ = fields[1].(string)
+	scope, _ = fields[2].(string)
+	return clientID, scope, nil
+}
+
+// Exists reports whether the session is still alive.
+func Exists(id string) (bool, error) {
+	n, err := redis.Client.Exists(redis.Ctx, sessionKey(id)).Result()
+	return n > 0, err
+}
+
+// touchScript stamps lastSeen on a session hash only while it exists, so a
+// request racing a revocation cannot bring the session back.
+var touchScript = goredis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+redis.call('HSET', KEYS[1], 'lastSeen', ARGV[1])
+return 1
+`)
+
+// extendScript is touchScript that also restarts the idle TTL of the session
+// and of the user's index and reschedules the session in sessions:active.
+var extendScript = goredis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+redis.call('HSET', KEYS[1], 'lastSeen', ARGV[1])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+redis.call('EXPIRE', KEYS[2], ARGV[2])
+redis.call('ZADD', KEYS[3], ARGV[3], ARGV[4])
+return 1
+`)
+
+// Touch records activity on a session without extending its lifetime.
+// Sessions that no longer exist are left alone.
+func Touch(id string) error {
+	return touchScript.Run(redis.Ctx, redis.Client, []string{sessionKey(id)}, time.Now().Unix()).Err()
+}
+
+// Extend records activity and restarts the session's idle TTL. It returns
+// ErrNotFound if the session has been revoked or has expired.
+func Extend(id, userID string) error {
+	now := time.Now()
+
+	keys := []string{sessionKey(id), userKey(userID), activeKey}
+	n, err := extendScript.Run(redis.Ctx, redis.Client, keys,
+		now.Unix(), int64(TTL/time.Second), int64(expiryScore(now)), id).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// BindAccessToken registers accessToken as the session's current access token,
+// making it valid for the service middlewares and invalidating the previous one.
+func BindAccessToken(id, userID, accessToken string, ttl time.Duration) error {
+	previous, err := redis.Client.HGet(redis.Ctx, sessionKey(id), "access").Result()
+	if err != nil && err != goredis.Nil {
+		return err
+	}
+
+	pipe := redis.Client.TxPipeline()
+	pipe.Set(redis.Ctx, accessToken, userID, ttl)
+	pipe.HSet(redis.Ctx, sessionKey(id), "access", accessToken)
+	if previous != "" && previous != accessToken {
+		pipe.Del(redis.Ctx, previous)
+	}
+	_, err = pipe.Exec(redis.Ctx)
+	return err
+}
+
+// List returns the live sessions of the user, most recently used first.
+// Index entries whose session has expired are pruned on the way.
+func List(userID string) ([]Session, error) {
+	ids, err := redis.Client.SMembers(redis.Ctx, userKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Session, 0, len(ids))
+	for _, id := range ids {
+		fields, err := redis.Client.HGetAll(redis.Ctx, sessionKey(id)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			redis.Client.SRem(redis.Ctx, userKey(userID), id)
+			redis.Client.ZRem(redis.Ctx, activeKey, id)
+			continue
+		}
+		list = append(list, Session{
+			ID:        id,
+			UserAgent: fields["userAgent"],
+			IP:        fields["ip"],
+			Client:    fields["client"],
+			Scope:     fields["scope"],
+			CreatedAt: unixField(fields["createdAt"]),
+			LastSeen:  unixField(fields["lastSeen"]),
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSeen.After(list[j].LastSeen) })
+	return list, nil
+}
+
+// Revoke ends a single session of the user, deleting its access token.
+// Every refresh token of the session stops working with it.
+func Revoke(userID, id string) error {
+	fields, err := redis.Client.HGetAll(redis.Ctx, sessionKey(id)).Result()
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 || fields["user"] != userID {
+		return ErrNotFound
+	}
+
+	pipe := redis.Client.TxPipeline()
+	pipe.Del(redis.Ctx, sessionKey(id))
+	if fields["access"] != "" {
+		pipe.Del(redis.Ctx, fields["access"])
+	}
+	pipe.SRem(redis.Ctx, userKey(userID), id)
+	if fields["client"] != "" {
+		pipe.SRem(redis.Ctx, clientKey(fields["client"]), id)
+	}
+	pipe.ZRem(redis.Ctx, activeKey, id)
+	_, err = pipe.Exec(redis.Ctx)
+	return err
+}
+
+// RevokeID ends a session without knowing its owner, as needed when a
+// replayed refresh token is detected.
+func RevokeID(id string) error {
+	userID, err := redis.Client.HGet(redis.Ctx, sessionKey(id), "user").Result()
+	if err == goredis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return Revoke(userID, id)
+}
+
+// RevokeAll ends every session of the user and returns how many were ended.
+func RevokeAll(userID string) (int, error) {
+	return RevokeOthers(userID, "")
+}
+
+// RevokeOthers ends every session of the user except keep and returns how
+// many were ended.
+func RevokeOthers(userID, keep string) (int, error) {
+	ids, err := redis.Client.SMembers(redis.Ctx, userKey(userID)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, id := range ids {
+		if id == keep {
+			continue
+		}
+		switch err := Revoke(userID, id); err {
+		case nil:
+			revoked++
+		case ErrNotFound:
+			redis.Client.SRem(redis.Ctx, userKey(userID), id)
+			redis.Client.ZRem(redis.Ctx, activeKey, id)
+		default:
+			return revoked, err
+		}
+	}
+	return revoked, nil
+}
+
+// RevokeClient ends every session of an OAuth client, across all users, and
+// returns how many were ended.
+func RevokeClient(clientID string) (int, error) {
+	ids, err := redis.Client.SMembers(redis.Ctx, clientKey(clientID)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, id := range ids {
+		alive, err := Exists(id)
+		if err != nil {
+			return revoked, err
+		}
+		if !alive {
+			continue
+		}
+		if err := RevokeID(id); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, redis.Client.Del(redis.Ctx, clientKey(clientID)).Err()
+}
+
+// CountActive returns the number of unexpired sessions across all users.
+// It backs the active_sessions gauge, so the value survives restarts.
+func CountActive() float64 {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := redis.Client.ZRemRangeByScore(redis.Ctx, activeKey, "-inf", "("+now).Err(); err != nil {
+		return 0
+	}
+	n, err := redis.Client.ZCard(redis.Ctx, activeKey).Result()
+	if err != nil {
+		return 0
+	}
+	return float64(n)
+}
+
+func unixField(v string) time.Time {
+	sec, _ := strconv.ParseInt(v, 10, 64)
+	return time.Unix(sec, 0).UTC()
+}
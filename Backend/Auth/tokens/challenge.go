@@ -0,0 +1,77 @@
+package tokens
+
+import (
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"authService.com/auth/utils"
+
+	"rysto/pkg/redis"
+)
+
+const (
+	// ChallengeTTL is how long a password-verified login waits for its
+	// second factor.
+	ChallengeTTL = 5 * time.Minute
+
+	maxChallengeAttempts = 5
+)
+
+// Redis layout:
+//
+//	mfa:<sha256(token)>               hash {user, attempts}
+//	totp_used:<userId>:<time step>    string, blocks replay of an accepted code
+func challengeKey(token string) string { return "mfa:" + utils.HashToken(token) }
+
+// IssueChallenge records that the user passed the password check and returns the
+// token that must be presented together with a second factor.
+func IssueChallenge(userID string) (string, error) {
+	token, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	pipe := redis.Client.TxPipeline()
+	pipe.HSet(redis.Ctx, challengeKey(token), "user", userID, "attempts", 0)
+	pipe.Expire(redis.Ctx, challengeKey(token), ChallengeTTL)
+	if _, err := pipe.Exec(redis.Ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// AttemptChallenge counts one verification attempt against a challenge and
+// returns its user ID. After too many attempts the challenge is destroyed.
+func AttemptChallenge(token string) (string, error) {
+	userID, err := redis.Client.HGet(redis.Ctx, challengeKey(token), "user").Result()
+	if err == goredis.Nil {
+		return "", ErrInvalidToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	attempts, err := redis.Client.HIncrBy(redis.Ctx, challengeKey(token), "attempts", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if attempts > maxChallengeAttempts {
+		redis.Client.Del(redis.Ctx, challengeKey(token))
+		return "", ErrInvalidToken
+	}
+	return userID, nil
+}
+
+// CompleteChallenge deletes a challenge once its second factor was accepted.
+func CompleteChallenge(token string) error {
+	return redis.Client.Del(redis.Ctx, challengeKey(token)).Err()
+}
+
+// MarkTOTPUsed records that the code for step was accepted and reports false
+// if it had already been used.
+func MarkTOTPUsed(userID string, step int64) (bool, error) {
+	key := "totp_used:" + userID + ":" + strconv.FormatInt(step, 10)
+	return redis.Client.SetNX(redis.Ctx, key, 1, 3*30*time.Second).Result()
+}
@@ -0,0 +1,64 @@
+package tokens
+
+import (
+	"errors"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"authService.com/auth/utils"
+
+	"rysto/pkg/redis"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Purposes of single-use tokens, used as Redis key prefixes.
+const (
+	PurposeVerifyEmail   = "verify"
+	PurposePasswordReset = "pwreset"
+	PurposeUnlock        = "unlock"
+	PurposeEmailChange   = "emailchange"
+	PurposeOIDCLogin     = "oidclogin"
+	PurposeMagicLogin    = "magiclogin"
+	PurposeAuthRequest   = "oauthreq"
+	PurposeAuthCode      = "oauthcode"
+	PurposeDeleteAccount = "deleteaccount"
+)
+
+// Redis layout:
+//
+//	<purpose>:<sha256(token)>  string value
+func oneTimeKey(purpose, token string) string { return purpose + ":" + utils.HashToken(token) }
+
+// IssueOneTime stores value under a fresh random token for ttl and returns the
+// token. Only its digest is kept in Redis.
+func IssueOneTime(purpose, value string, ttl time.Duration) (string, error) {
+	token, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := redis.Client.Set(redis.Ctx, oneTimeKey(purpose, token), value, ttl).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// PeekOneTime returns the value stored for token without using it up.
+func PeekOneTime(purpose, token string) (string, error) {
+	value, err := redis.Client.Get(redis.Ctx, oneTimeKey(purpose, token)).Result()
+	if err == goredis.Nil {
+		return "", ErrInvalidToken
+	}
+	return value, err
+}
+
+// ConsumeOneTime returns the value stored for token and deletes it, so each
+// token works exactly once.
+func ConsumeOneTime(purpose, token string) (string, error) {
+	value, err := redis.Client.GetDel(redis.Ctx, oneTimeKey(purpose, token)).Result()
+	if err == goredis.Nil {
+		return "", ErrInvalidToken
+	}
+	return value, err
+}
@@ -0,0 +1,95 @@
+package tokens
+
+import (
+	"errors"
+
+	"authService.com/auth/sessions"
+	"authService.com/auth/utils"
+
+	"rysto/pkg/redis"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// Every refresh token belongs to a family, which is the session it was first
+// issued for. Redis layout:
+//
+//	refresh:<sha256(token)>  hash {user, family, used}
+func refreshKey(token string) string { return "refresh:" + utils.HashToken(token) }
+
+// Issue creates a new refresh token in the given session's family.
+func Issue(family, userID string) (string, error) {
+	refresh, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	pipe := redis.Client.TxPipeline()
+	pipe.HSet(redis.Ctx, refreshKey(refresh), "user", userID, "family", family, "used", 0)
+	pipe.Expire(redis.Ctx, refreshKey(refresh), sessions.TTL)
+	if _, err := pipe.Exec(redis.Ctx); err != nil {
+		return "", err
+	}
+	return refresh, nil
+}
+
+// Rotate consumes a refresh token and returns the owning user ID, the family ID
+// and a replacement refresh token. clientID is the OAuth client presenting
+// the token, or "" for Rysto's own clients; a token issued to anyone else is
+// rejected without being consumed. Presenting a token that was already
+// rotated revokes the whole family and returns ErrRefreshTokenReused.
+func Rotate(refresh, clientID string) (userID, family, next string, err error) {
+	record, err := redis.Client.HGetAll(redis.Ctx, refreshKey(refresh)).Result()
+	if err != nil {
+		return "", "", "", err
+	}
+	if len(record) == 0 {
+		return "", "", "", ErrInvalidRefreshToken
+	}
+	userID, family = record["user"], record["family"]
+
+	owner, _, err := sessions.ClientOf(family)
+	if err == sessions.ErrNotFound || (err == nil && owner != clientID) {
+		return "", "", "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+
+	// HINCRBY is atomic, so of two concurrent uses exactly one sees 1.
+	used, err := redis.Client.HIncrBy(redis.Ctx, refreshKey(refresh), "used", 1).Result()
+	if err != nil {
+		return "", "", "", err
+	}
+	if used > 1 {
+		if err := sessions.RevokeID(family); err != nil {
+			return "", "", "", err
+		}
+		return userID, family, "", ErrRefreshTokenReused
+	}
+
+	alive, err := sessions.Exists(family)
+	if err != nil {
+		return "", "", "", err
+	}
+	if !alive {
+		return "", "", "", ErrInvalidRefreshToken
+	}
+
+	next, err = Issue(family, userID)
+	if err != nil {
+		return "", "", "", err
+	}
+	switch err := sessions.Extend(family, userID); err {
+	case nil:
+	case sessions.ErrNotFound:
+		// Revoked since the check above.
+		return "", "", "", ErrInvalidRefreshToken
+	default:
+		return "", "", "", err
+	}
+	return userID, family, next, nil
+}
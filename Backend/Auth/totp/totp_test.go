@@ -0,0 +1,59 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors,
+// "12345678901234567890", in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		at       int64
+		wantStep int64
+		wantOK   bool
+	}{
+		// Codes are the last six digits of the RFC 6238 appendix B values.
+		{name: "RFC vector at 59", secret: rfcSecret, code: "287082", at: 59, wantStep: 1, wantOK: true},
+		{name: "RFC vector at 1111111109", secret: rfcSecret, code: "081804", at: 1111111109, wantStep: 37037036, wantOK: true},
+		{name: "RFC vector at 2000000000", secret: rfcSecret, code: "279037", at: 2000000000, wantStep: 66666666, wantOK: true},
+		{name: "lowercase secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code: "287082", at: 59, wantStep: 1, wantOK: true},
+		{name: "spaces in code", secret: rfcSecret, code: " 287 082 ", at: 59, wantStep: 1, wantOK: true},
+		{name: "one step late", secret: rfcSecret, code: "287082", at: 59 + period, wantStep: 1, wantOK: true},
+		{name: "one step early", secret: rfcSecret, code: "287082", at: 59 - period, wantStep: 1, wantOK: true},
+		{name: "two steps late", secret: rfcSecret, code: "287082", at: 59 + 2*period},
+		{name: "wrong code", secret: rfcSecret, code: "287083", at: 59},
+		{name: "too short", secret: rfcSecret, code: "28708", at: 59},
+		{name: "too long", secret: rfcSecret, code: "2870820", at: 59},
+		{name: "invalid secret", secret: "not base32!", code: "287082", at: 59},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(tt.secret, tt.code, time.Unix(tt.at, 0))
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate = (%d, %v), want (%d, %v)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateGeneratedSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, err := Code(secret, now.Unix()/period)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step, ok := Validate(secret, code, now); !ok || step != now.Unix()/period {
+		t.Errorf("Validate = (%d, %v), want (%d, true)", step, ok, now.Unix()/period)
+	}
+}
@@ -1,65 +1,160 @@
 package utils
 
 import (
+	"crypto"
+	"fmt"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+
+	"authService.com/auth/models"
+
+	"rysto/pkg/token"
 )
 
-var jwtKey []byte // This will be set from an environment variable
+var (
+	signer    *token.Signer
+	validator *token.Validator
+	jwks      = token.JWKSet{Keys: []token.JWK{}}
+)
+
+// AccessTokenTTL is how long an access token (and its Redis entry) stays valid.
+// Clients renew it through POST /refresh before it runs out.
+const AccessTokenTTL = 15 * time.Minute
+
+// ServiceTokenTTL bounds the tokens Auth uses to call other services. They
+// are not stored in Redis, so they must expire quickly.
+const ServiceTokenTTL = time.Minute
+
+// ServiceSubject is the subject of service tokens.
+const ServiceSubject = "service:auth"
 
 // SetJWTSecret initializes the JWT secret key.
 func SetJWTSecret(secret []byte) {
-	jwtKey = secret
+	signer = token.NewSigner(secret)
+	validator = token.NewValidator(secret)
 }
 
-// Claims defines the structure of the JWT payload.
-type Claims struct {
-	Email string `json:"email"`
-	jwt.RegisteredClaims
+// LoadSigningKeys reads a comma-separated list of PEM private key files. The
+// first key signs new tokens; the others stay published in the JWKS and
+// accepted, so tokens signed before a key rotation remain valid until they
+// expire.
+func LoadSigningKeys(paths string) error {
+	var keys []crypto.Signer
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		key, err := token.ParsePrivateKeyPEM(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no signing keys in %q", paths)
+	}
+	return SetSigningKeys(keys)
 }
 
-// GenerateToken creates a new JWT for the given email.
-func GenerateToken(email string) (string, error) {
-	expirationTime := time.Now().Add(72 * time.Hour)
+// SetSigningKeys switches to asymmetric signing with keys[0] and publishes the
+// public half of every key.
+func SetSigningKeys(keys []crypto.Signer) error {
+	published := token.JWKSet{Keys: []token.JWK{}}
+	verify := token.StaticKeys{}
 
-	claims := &Claims{
-		Email: email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "rysto-auth-service",
-		},
+	for i, key := range keys {
+		jwk, err := token.NewJWK("", key.Public())
+		if err != nil {
+			return err
+		}
+		if _, dup := verify[jwk.Kid]; dup {
+			continue
+		}
+		if i == 0 {
+			s, err := token.NewKeySigner(jwk.Kid, key)
+			if err != nil {
+				return err
+			}
+			signer = s
+		}
+		verify[jwk.Kid] = key.Public()
+		published.Keys = append(published.Keys, jwk)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	validator = token.NewKeyValidator(verify)
+	jwks = published
+	return nil
 }
 
-// ValidateToken parses and validates a JWT string.
-func ValidateToken(tokenStr string) (*Claims, error) {
-	claims := &Claims{}
+// JWKS returns the public signing keys. It is empty when tokens are signed
+// with the shared HS256 secret.
+func JWKS() token.JWKSet {
+	return jwks
+}
 
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return jwtKey, nil
+// Validator returns the validator for tokens issued by this service.
+func Validator() *token.Validator {
+	return validator
+}
+
+// GenerateToken creates a new short-lived access token for the given user.
+// sessionID ties the token to the refresh token family it was issued from.
+func GenerateToken(user *models.User, sessionID string) (string, error) {
+	now := time.Now()
+
+	return signer.Sign(&token.Claims{
+		Email:         user.Email,
+		Handle:        user.Handle,
+		EmailVerified: user.Verified,
+		SessionID:     sessionID,
+		Roles:         user.Roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.Hex(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
 	})
+}
 
-	if err != nil || !token.Valid {
-		return nil, err
-	}
+// GenerateClientToken creates an access token for a third-party OAuth client
+// acting for user. It is limited to scope, carries no roles and no email, and
+// belongs to the session that holds the client's refresh token.
+func GenerateClientToken(user *models.User, sessionID, clientID, scope string) (string, error) {
+	now := time.Now()
 
-	return claims, nil
+	return signer.Sign(&token.Claims{
+		Handle:        user.Handle,
+		EmailVerified: user.Verified,
+		SessionID:     sessionID,
+		Scope:         scope,
+		ClientID:      clientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.Hex(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
 }
 
-// ExtractToken safely parses the token from the Authorization header.
-func ExtractToken(authHeader string) string {
-	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-		return ""
-	}
-	return strings.TrimSpace(parts[1])
+// GenerateServiceToken creates a token carrying only the service role, for
+// Auth's calls to the internal endpoints of Stories and Voting.
+func GenerateServiceToken() (string, error) {
+	now := time.Now()
+
+	return signer.Sign(&token.Claims{
+		Roles: []string{token.RoleService},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   ServiceSubject,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ServiceTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
 }
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"storyService.com/story/metrics"
+	"storyService.com/story/models"
+
+	"rysto/pkg/purge"
+	"rysto/pkg/takeout"
+)
+
+// PurgeUser anonymizes or removes the stories and continuations of a deleted
+// account. Called by Auth with a service token; safe to repeat.
+func PurgeUser(c *gin.Context) {
+	start := time.Now()
+
+	var req purge.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		metrics.HttpRequests.WithLabelValues("/internal/users/:id/purge", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.Param("id")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var counts map[string]int64
+	var removed []primitive.ObjectID
+	var err error
+	if req.Mode == purge.ModeDelete {
+		counts, removed, err = models.DeleteByAuthor(ctx, userID)
+	} else {
+		counts, err = models.AnonymizeAuthor(ctx, userID)
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/internal/users/:id/purge", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge user content"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/internal/users/:id/purge", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/internal/users/:id/purge").Observe(time.Since(start).Seconds())
+	report := purge.Report{Service: "stories", Mode: req.Mode, Counts: counts}
+	for _, id := range removed {
+		report.RemovedContinuations = append(report.RemovedContinuations, id.Hex())
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// RenameUserInput is the body of PUT /internal/users/:id/handle.
+type RenameUserInput struct {
+	Handle string `json:"handle" binding:"required"`
+}
+
+// RenameUser moves the stories and continuations of an account to its new
+// handle. Called by Auth with a service token when the handle changes.
+func RenameUser(c *gin.Context) {
+	start := time.Now()
+
+	var input RenameUserInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.HttpRequests.WithLabelValues("/internal/users/:id/handle", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	counts, err := models.SetAuthorHandle(ctx, c.Param("id"), input.Handle)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/internal/users/:id/handle", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update author handle"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/internal/users/:id/handle", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/internal/users/:id/handle").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, counts)
+}
+
+// ExportUser returns everything a user wrote, for Auth's data export.
+func ExportUser(c *gin.Context) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stories, continuations, err := models.FindByAuthor(ctx, c.Param("id"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/internal/users/:id/export", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user content"})
+		return
+	}
+
+	storyIDs := make([]primitive.ObjectID, 0, len(continuations))
+	for _, cont := range continuations {
+		storyIDs = append(storyIDs, cont.StoryID)
+	}
+	titles, err := models.StoryTitles(ctx, storyIDs)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/internal/users/:id/export", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load story titles"})
+		return
+	}
+
+	export := takeout.StoriesExport{
+		Stories:       make([]takeout.Story, 0, len(stories)),
+		Continuations: make([]takeout.Continuation, 0, len(continuations)),
+	}
+	for _, s := range stories {
+		export.Stories = append(export.Stories, takeout.Story{
+			ID:        s.ID.Hex(),
+			Title:     s.Title,
+			Content:   s.Content,
+			Tags:      s.Tags,
+			CreatedAt: s.CreatedAt,
+		})
+	}
+	for _, cont := range continuations {
+		export.Continuations = append(export.Continuations, takeout.Continuation{
+			ID:         cont.ID.Hex(),
+			StoryID:    cont.StoryID.Hex(),
+			StoryTitle: titles[cont.StoryID],
+			Content:    cont.Content,
+			Accepted:   cont.Accepted,
+			CreatedAt:  cont.CreatedAt,
+		})
+	}
+
+	metrics.HttpRequests.WithLabelValues("/internal/users/:id/export", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/internal/users/:id/export").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, export)
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"storyService.com/story/metrics"
+	"storyService.com/story/models"
+)
+
+// ModerateDeleteStory removes any story and its continuations, regardless of
+// author. Routed behind the moderator role.
+func ModerateDeleteStory(c *gin.Context) {
+	start := time.Now()
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/moderation/stories/delete", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid story ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := models.StoryCollection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/moderation/stories/delete", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete story"})
+		return
+	}
+	if res.DeletedCount == 0 {
+		metrics.HttpRequests.WithLabelValues("/moderation/stories/delete", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Story not found"})
+		return
+	}
+
+	_ = models.DeleteContinuationsByStoryID(ctx, id)
+
+	metrics.StoriesDeleted.Inc()
+	metrics.ModerationRemovals.WithLabelValues("story").Inc()
+	metrics.HttpRequests.WithLabelValues("/moderation/stories/delete", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/moderation/stories/delete").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "Story and its continuations removed by moderator"})
+}
+
+// ModerateDeleteContinuation removes any continuation of a story, including
+// accepted ones, together with the continuations below it. Routed behind the
+// moderator role.
+func ModerateDeleteContinuation(c *gin.Context) {
+	start := time.Now()
+	storyID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/moderation/continuations/delete", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid story ID"})
+		return
+	}
+	cid, err := primitive.ObjectIDFromHex(c.Param("cid"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/moderation/continuations/delete", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid continuation ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := models.DeleteSubtree(ctx, storyID, cid)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/moderation/continuations/delete", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete continuation"})
+		return
+	}
+	if deleted == 0 {
+		metrics.HttpRequests.WithLabelValues("/moderation/continuations/delete", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Continuation not found"})
+		return
+	}
+
+	metrics.ContinuationsDeleted.Add(float64(deleted))
+	metrics.ModerationRemovals.WithLabelValues("continuation").Add(float64(deleted))
+	metrics.HttpRequests.WithLabelValues("/moderation/continuations/delete", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/moderation/continuations/delete").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{"message": "Continuation removed by moderator", "removed": deleted})
+}
@@ -3,19 +3,25 @@ package controllers
 import (
 	"context"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"storyService.com/story/models"
 	"storyService.com/story/metrics"
 )
 
-func getUserEmail(c *gin.Context) string {
-	email, _ := c.Get("email")
-	return email.(string)
+func getUserID(c *gin.Context) string {
+	return c.GetString("userId")
+}
+
+func getUserHandle(c *gin.Context) string {
+	return c.GetString("handle")
 }
 
 // CreateStory
@@ -33,11 +39,12 @@ func CreateStory(c *gin.Context) {
 	}
 
 	story := models.Story{
-		AuthorID:  getUserEmail(c),
-		Content:   req.Content,
-		Title:     req.Title,
-		Tags:      req.Tags,
-		CreatedAt: time.Now(),
+		AuthorID:     getUserID(c),
+		AuthorHandle: getUserHandle(c),
+		Content:      req.Content,
+		Title:        req.Title,
+		Tags:         req.Tags,
+		CreatedAt:    time.Now(),
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -63,7 +70,8 @@ func CreateStory(c *gin.Context) {
 func AddContinuation(c *gin.Context) {
 	start := time.Now()
 	var req struct {
-		Content string `json:"content" binding:"required"`
+		Content  string `json:"content" binding:"required"`
+		ParentID string `json:"parentId"` // continuation being continued; empty for the opening
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		metrics.HttpRequests.WithLabelValues("/continuations", "400").Inc()
@@ -79,16 +87,40 @@ func AddContinuation(c *gin.Context) {
 	}
 
 	cont := models.Continuation{
-		StoryID:   storyID,
-		AuthorID:  getUserEmail(c),
-		Content:   req.Content,
-		CreatedAt: time.Now(),
-		Accepted:  false,
+		StoryID:      storyID,
+		AuthorID:     getUserID(c),
+		AuthorHandle: getUserHandle(c),
+		Content:      req.Content,
+		CreatedAt:    time.Now(),
+		Accepted:     false,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if req.ParentID != "" {
+		parentID, err := primitive.ObjectIDFromHex(req.ParentID)
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/continuations", "400").Inc()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid parent ID"})
+			return
+		}
+		var parent models.Continuation
+		err = models.ContinuationCollection.FindOne(ctx, bson.M{"_id": parentID, "storyId": storyID}).Decode(&parent)
+		if err == mongo.ErrNoDocuments {
+			metrics.HttpRequests.WithLabelValues("/continuations", "404").Inc()
+			c.JSON(http.StatusNotFound, gin.H{"error": "Parent continuation not found in this story"})
+			return
+		}
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/continuations", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit continuation"})
+			return
+		}
+		cont.ParentID = &parent.ID
+		cont.Ancestors = append(append([]primitive.ObjectID{}, parent.Ancestors...), parent.ID)
+	}
+
 	res, err := models.ContinuationCollection.InsertOne(ctx, cont)
 	if err != nil {
 		metrics.HttpRequests.WithLabelValues("/continuations", "500").Inc()
@@ -118,7 +150,7 @@ func EditStory(c *gin.Context) {
 	}
 
 	id, _ := primitive.ObjectIDFromHex(c.Param("id"))
-	authorID := getUserEmail(c)
+	authorID := getUserID(c)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -151,7 +183,7 @@ func EditContinuation(c *gin.Context) {
 	}
 
 	cid, _ := primitive.ObjectIDFromHex(c.Param("cid"))
-	authorID := getUserEmail(c)
+	authorID := getUserID(c)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -175,7 +207,7 @@ func EditContinuation(c *gin.Context) {
 func DeleteStory(c *gin.Context) {
 	start := time.Now()
 	id, _ := primitive.ObjectIDFromHex(c.Param("id"))
-	authorID := getUserEmail(c)
+	authorID := getUserID(c)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -198,12 +230,39 @@ func DeleteStory(c *gin.Context) {
 func DeleteContinuation(c *gin.Context) {
 	start := time.Now()
 	cid, _ := primitive.ObjectIDFromHex(c.Param("cid"))
-	authorID := getUserEmail(c)
+	authorID := getUserID(c)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	filter := bson.M{"_id": cid, "authorId": authorID, "accepted": false}
+	var cont models.Continuation
+	err := models.ContinuationCollection.FindOne(ctx, filter).Decode(&cont)
+	if err == mongo.ErrNoDocuments {
+		metrics.HttpRequests.WithLabelValues("/continuations/delete", "403").Inc()
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized or continuation locked"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/continuations/delete", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete continuation"})
+		return
+	}
+
+	// Deleting it would cut the continuations below it off the story.
+	replies, err := models.ContinuationCollection.CountDocuments(ctx,
+		bson.M{"storyId": cont.StoryID, "ancestors": cid}, options.Count().SetLimit(1))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/continuations/delete", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete continuation"})
+		return
+	}
+	if replies > 0 {
+		metrics.HttpRequests.WithLabelValues("/continuations/delete", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Continuation has been continued and cannot be deleted"})
+		return
+	}
+
 	res, err := models.ContinuationCollection.DeleteOne(ctx, filter)
 	if err != nil || res.DeletedCount == 0 {
 		metrics.HttpRequests.WithLabelValues("/continuations/delete", "403").Inc()
@@ -216,12 +275,14 @@ func DeleteContinuation(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Continuation deleted"})
 }
 
-// AcceptContinuation
+// AcceptContinuation extends the story's canonical storyline with a
+// continuation of the opening or of a continuation already on it. Anything
+// the storyline held below that point is replaced.
 func AcceptContinuation(c *gin.Context) {
 	start := time.Now()
 	storyID, _ := primitive.ObjectIDFromHex(c.Param("id"))
 	cid, _ := primitive.ObjectIDFromHex(c.Param("cid"))
-	authorID := getUserEmail(c)
+	authorID := getUserID(c)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -234,19 +295,71 @@ func AcceptContinuation(c *gin.Context) {
 		return
 	}
 
-	_, err = models.StoryCollection.UpdateOne(ctx, bson.M{"_id": storyID}, bson.M{"$set": bson.M{"accepted": cid}})
+	var cont models.Continuation
+	err = models.ContinuationCollection.FindOne(ctx, bson.M{"_id": cid, "storyId": storyID}).Decode(&cont)
+	if err == mongo.ErrNoDocuments {
+		metrics.HttpRequests.WithLabelValues("/continuations/accept", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Continuation not found in this story"})
+		return
+	}
 	if err != nil {
 		metrics.HttpRequests.WithLabelValues("/continuations/accept", "500").Inc()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept continuation"})
 		return
 	}
 
-	_, _ = models.ContinuationCollection.UpdateOne(ctx, bson.M{"_id": cid}, bson.M{"$set": bson.M{"accepted": true}})
+	path, err := story.ExtendPath(&cont)
+	if err == models.ErrAlreadyAccepted {
+		metrics.HttpRequests.WithLabelValues("/continuations/accept", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Continuation is already on the accepted storyline"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/continuations/accept", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Continuation does not continue the accepted storyline"})
+		return
+	}
+
+	// The path read above must still be the current one, so concurrent
+	// accepts cannot interleave.
+	filter := bson.M{"_id": storyID, "acceptedPath": story.AcceptedPath}
+	if len(story.AcceptedPath) == 0 {
+		filter["acceptedPath"] = nil
+	}
+	res, err := models.StoryCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"acceptedPath": path}})
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/continuations/accept", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept continuation"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		metrics.HttpRequests.WithLabelValues("/continuations/accept", "409").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "The storyline changed meanwhile, try again"})
+		return
+	}
+
+	// Continuations that fell off the storyline are open for edits again.
+	if _, err := models.ContinuationCollection.UpdateMany(ctx,
+		bson.M{"storyId": storyID, "accepted": true, "_id": bson.M{"$nin": path}},
+		bson.M{"$set": bson.M{"accepted": false}},
+	); err != nil {
+		metrics.HttpRequests.WithLabelValues("/continuations/accept", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Storyline updated but failed to unlock the continuations that left it"})
+		return
+	}
+	if _, err := models.ContinuationCollection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": path}},
+		bson.M{"$set": bson.M{"accepted": true}},
+	); err != nil {
+		metrics.HttpRequests.WithLabelValues("/continuations/accept", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Storyline updated but failed to lock its continuations"})
+		return
+	}
 
 	metrics.HttpRequests.WithLabelValues("/continuations/accept", "200").Inc()
 	metrics.ContinuationsAccepted.Inc()
 	metrics.HttpRequestDuration.WithLabelValues("/continuations/accept").Observe(time.Since(start).Seconds())
-	c.JSON(http.StatusOK, gin.H{"message": "Continuation accepted"})
+	c.JSON(http.StatusOK, gin.H{"message": "Continuation accepted", "acceptedPath": path})
 }
 
 // GetAllStoriesWithContinuations
@@ -396,17 +509,19 @@ func GetStoriesByTitle(c *gin.Context) {
 // GetStoriesByAuthor
 func GetStoriesByAuthor(c *gin.Context) {
 	start := time.Now()
-	authorID := c.Query("authorId")
-	if authorID == "" {
+	filter := bson.M{"authorId": c.Query("authorId")}
+	if handle := c.Query("handle"); handle != "" {
+		filter = bson.M{"authorHandle": strings.ToLower(strings.TrimPrefix(handle, "@"))}
+	} else if c.Query("authorId") == "" {
 		metrics.HttpRequests.WithLabelValues("/stories/author", "400").Inc()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "authorId query parameter is required"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "authorId or handle query parameter is required"})
 		return
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	var stories []models.Story
-	storiesCollections, err := models.StoryCollection.Find(ctx, bson.M{"authorId": authorID})
+	storiesCollections, err := models.StoryCollection.Find(ctx, filter)
 	if err != nil {
 		metrics.HttpRequests.WithLabelValues("/stories/author", "500").Inc()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stories"})
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"storyService.com/story/metrics"
+	"storyService.com/story/models"
+)
+
+// continuationParams parses the story and continuation IDs of the path. On
+// failure it has already written the response.
+func continuationParams(c *gin.Context, path string) (storyID, cid primitive.ObjectID, ok bool) {
+	storyID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues(path, "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid story ID"})
+		return storyID, cid, false
+	}
+	cid, err = primitive.ObjectIDFromHex(c.Param("cid"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues(path, "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid continuation ID"})
+		return storyID, cid, false
+	}
+	return storyID, cid, true
+}
+
+// GetContinuationSubtree returns a continuation with every continuation
+// below it, nested under their parents.
+func GetContinuationSubtree(c *gin.Context) {
+	start := time.Now()
+	storyID, cid, ok := continuationParams(c, "/continuations/subtree")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	continuations, err := models.Subtree(ctx, storyID, cid)
+	if err == mongo.ErrNoDocuments {
+		metrics.HttpRequests.WithLabelValues("/continuations/subtree", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Continuation not found"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/continuations/subtree", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch continuations"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/continuations/subtree", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/continuations/subtree").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, models.BuildTree(cid, continuations))
+}
+
+// GetContinuationPath returns the story and the single line of continuations
+// leading from its opening down to a continuation.
+func GetContinuationPath(c *gin.Context) {
+	start := time.Now()
+	storyID, cid, ok := continuationParams(c, "/continuations/path")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var story models.Story
+	if err := models.StoryCollection.FindOne(ctx, bson.M{"_id": storyID}).Decode(&story); err != nil {
+		metrics.HttpRequests.WithLabelValues("/continuations/path", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Story not found"})
+		return
+	}
+
+	path, err := models.Path(ctx, storyID, cid)
+	if err == mongo.ErrNoDocuments {
+		metrics.HttpRequests.WithLabelValues("/continuations/path", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Continuation not found"})
+		return
+	}
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/continuations/path", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch continuations"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/continuations/path", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/continuations/path").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, gin.H{
+		"story":         story,
+		"continuations": path,
+	})
+}
@@ -8,16 +8,19 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"storyService.com/story/controllers"
 	"storyService.com/story/middleware"
 	"storyService.com/story/models"
-	"storyService.com/story/redis"
-	"storyService.com/story/utils"
 	"storyService.com/story/metrics"
+
+	"rysto/pkg/introspect"
+	pkgmetrics "rysto/pkg/metrics"
+	"rysto/pkg/redis"
+	"rysto/pkg/token"
+	"rysto/pkg/userstatus"
 )
 
 func main() {
@@ -34,22 +37,42 @@ func main() {
 	}
 	gin.SetMode(ginMode)
 
-	// --- JWT Secret ---
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("Error: JWT_SECRET not set")
+	// --- Token validation ---
+	validator, err := token.ValidatorFromEnv()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
 	}
-	utils.SetJWTSecret([]byte(jwtSecret))
+	middleware.SetValidator(validator)
 
-	// --- Redis ---
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		log.Fatal("Error: REDIS_ADDR not set")
+	// --- Token checks ---
+	// With AUTH_INTROSPECT_URL set, Auth is asked whether tokens are still
+	// valid and Redis is optional; otherwise Auth's Redis keys are read.
+	introspector, err := introspect.FromEnv()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if introspector != nil {
+		middleware.SetIntrospector(introspector)
+		log.Println("Checking tokens through Auth's introspection endpoint")
+		// Cached verdicts are dropped as Auth announces suspensions and
+		// bans; with no Redis to hear them on, nothing is cached.
+		if os.Getenv("REDIS_ADDR") != "" {
+			redis.InitRedis()
+			go userstatus.Watch(context.Background(), redis.Client, introspector.Evict)
+		} else {
+			introspector.DisableCache()
+			log.Println("REDIS_ADDR not set: introspection verdicts are not cached")
+		}
+	} else {
+		redisAddr := os.Getenv("REDIS_ADDR")
+		if redisAddr == "" {
+			log.Fatal("Error: REDIS_ADDR not set")
+		}
+		os.Setenv("REDIS_ADDR", redisAddr)
+		log.Println("Connecting to Redis...")
+		redis.InitRedis()
+		log.Println("Redis connected successfully!")
 	}
-	os.Setenv("REDIS_ADDR", redisAddr)
-	log.Println("Connecting to Redis...")
-	redis.InitRedis()
-	log.Println("Redis connected successfully!")
 
 	// --- MongoDB ---
 	mongoURI := os.Getenv("MONGODB_URI")
@@ -85,6 +108,14 @@ func main() {
 	// --- Inject story collections ---
 	db := client.Database("RystoDB")
 	models.InitCollections(db)
+	if err := models.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create continuation indexes: %v", err)
+	}
+	if n, err := models.BackfillAcceptedPaths(ctx); err != nil {
+		log.Fatalf("Failed to backfill accepted paths: %v", err)
+	} else if n > 0 {
+		log.Printf("Gave %d stories with an accepted continuation a storyline", n)
+	}
 
 	// --- Setup Gin routes ---
 	r := gin.Default()
@@ -93,22 +124,44 @@ func main() {
 	r.Use(metrics.PrometheusMiddleware())
 
 	// Metrics endpoint
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/metrics", pkgmetrics.Handler())
+
+	// API keys and tokens of third-party OAuth apps only reach the routes
+	// their scopes allow; session tokens are unrestricted.
+	read := middleware.RequireScope(token.ScopeStoriesRead)
+	write := middleware.RequireScope(token.ScopeStoriesWrite)
 
 	auth := r.Group("/api")
 	auth.Use(middleware.AuthMiddleware())
 	{
-		auth.POST("/stories", controllers.CreateStory)
-		auth.POST("/stories/:id/continuations", controllers.AddContinuation)
-		auth.PUT("/stories/:id", controllers.EditStory)
-		auth.PUT("/stories/:id/continuations/:cid", controllers.EditContinuation)
-		auth.DELETE("/stories/:id", controllers.DeleteStory)
-		auth.DELETE("/stories/:id/continuations/:cid", controllers.DeleteContinuation)
-		auth.POST("/stories/:id/accept/:cid", controllers.AcceptContinuation)
-		auth.GET("/stories/all", controllers.GetAllStoriesWithContinuations)
-		auth.GET("/stories/:id", controllers.GetStoryByID)
-		auth.GET("/stories/by-title", controllers.GetStoriesByTitle)
-		auth.GET("/stories/by-author", controllers.GetStoriesByAuthor)
+		auth.POST("/stories", write, middleware.RequireVerified(), controllers.CreateStory)
+		auth.POST("/stories/:id/continuations", write, middleware.RequireVerified(), controllers.AddContinuation)
+		auth.PUT("/stories/:id", write, controllers.EditStory)
+		auth.PUT("/stories/:id/continuations/:cid", write, controllers.EditContinuation)
+		auth.DELETE("/stories/:id", write, controllers.DeleteStory)
+		auth.DELETE("/stories/:id/continuations/:cid", write, controllers.DeleteContinuation)
+		auth.POST("/stories/:id/accept/:cid", write, controllers.AcceptContinuation)
+		auth.GET("/stories/:id/continuations/:cid/subtree", read, controllers.GetContinuationSubtree)
+		auth.GET("/stories/:id/continuations/:cid/path", read, controllers.GetContinuationPath)
+		auth.GET("/stories/all", read, controllers.GetAllStoriesWithContinuations)
+		auth.GET("/stories/:id", read, controllers.GetStoryByID)
+		auth.GET("/stories/by-title", read, controllers.GetStoriesByTitle)
+		auth.GET("/stories/by-author", read, controllers.GetStoriesByAuthor)
+	}
+
+	internal := r.Group("/internal")
+	internal.Use(middleware.ServiceAuth(), middleware.RequireRole(token.RoleService))
+	{
+		internal.POST("/users/:id/purge", controllers.PurgeUser)
+		internal.GET("/users/:id/export", controllers.ExportUser)
+		internal.PUT("/users/:id/handle", controllers.RenameUser)
+	}
+
+	moderation := r.Group("/api/moderation")
+	moderation.Use(middleware.AuthMiddleware(), middleware.RequireRole(token.RoleModerator))
+	{
+		moderation.DELETE("/stories/:id", controllers.ModerateDeleteStory)
+		moderation.DELETE("/stories/:id/continuations/:cid", controllers.ModerateDeleteContinuation)
 	}
 
 	// --- Run server ---
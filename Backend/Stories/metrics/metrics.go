@@ -1,32 +1,19 @@
 package metrics
 
 import (
-	"strconv"
-	"time"
-
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	pkgmetrics "rysto/pkg/metrics"
 )
 
+var httpMetrics = pkgmetrics.NewHTTPMetrics("story_")
+
 var (
 	// HTTP metrics
-	HttpRequests = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "story_http_requests_total",
-			Help: "Total number of HTTP requests processed by StoryService, labeled by endpoint and status",
-		},
-		[]string{"endpoint", "status"},
-	)
-
-	HttpRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "story_http_request_duration_seconds",
-			Help:    "Duration of HTTP requests in seconds for StoryService",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"endpoint"},
-	)
+	HttpRequests        = httpMetrics.Requests
+	HttpRequestDuration = httpMetrics.Duration
 
 	// Business metrics
 	StoriesCreated = promauto.NewCounter(
@@ -63,23 +50,17 @@ var (
 			Help: "Total number of continuations deleted",
 		},
 	)
+
+	ModerationRemovals = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "moderation_removals_total",
+			Help: "Total number of stories and continuations removed by moderators",
+		},
+		[]string{"kind"},
+	)
 )
 
 // 🔹 Middleware for Prometheus
 func PrometheusMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		start := time.Now()
-		c.Next()
-
-		endpoint := c.FullPath()
-		if endpoint == "" {
-			endpoint = "unknown"
-		}
-
-		status := strconv.Itoa(c.Writer.Status())
-		HttpRequests.WithLabelValues(endpoint, status).Inc()
-
-		duration := time.Since(start).Seconds()
-		HttpRequestDuration.WithLabelValues(endpoint).Observe(duration)
-	}
+	return httpMetrics.Middleware()
 }
@@ -1,55 +1,63 @@
 package middleware
 
 import (
-	"net/http"
-	
-
 	"github.com/gin-gonic/gin"
-	"storyService.com/story/utils"
-	"storyService.com/story/redis"
+
+	"rysto/pkg/introspect"
+	pkgmiddleware "rysto/pkg/middleware"
+	"rysto/pkg/redis"
+	"rysto/pkg/token"
+)
+
+var (
+	validator    *token.Validator
+	introspector *introspect.Client
 )
 
+// SetValidator configures the validator for tokens issued by the Auth service.
+func SetValidator(v *token.Validator) {
+	validator = v
+}
+
+// SetIntrospector makes AuthMiddleware ask Auth's /introspect about tokens
+// and API keys instead of reading Redis.
+func SetIntrospector(client *introspect.Client) {
+	introspector = client
+}
+
+// AuthMiddleware accepts tokens that Auth signed and still keeps in Redis, and
+// API keys Auth issued, asking Auth when an introspector is set. Suspended
+// and banned users get a 403. Routes restrict keys further with RequireScope.
 func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
-			return
-		}
-
-		token := utils.ExtractToken(authHeader)
-		if token == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header must be Bearer <token>"})
-			c.Abort()
-			return
-		}
-
-		// log.Printf("AuthMiddleware: token extracted: %s", token)
-
-		claims, err := utils.ValidateToken(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token verification failed"})
-			c.Abort()
-			return
-		}
-
-		email, err := redis.Client.Get(redis.Ctx, token).Result()
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
-			return
-		}
-
-		if claims.Email != email {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token mismatch"})
-			c.Abort()
-			return
-		}
-
-		c.Set("email", email)
-		c.Set("token", token)
-
-		c.Next()
+	if introspector != nil {
+		return pkgmiddleware.AuthWithAPIKeys(validator,
+			pkgmiddleware.IntrospectionCheck(introspector),
+			pkgmiddleware.IntrospectedAPIKeys(introspector))
 	}
+	return pkgmiddleware.AuthWithAPIKeys(validator,
+		pkgmiddleware.RedisTokenCheck(redis.Client),
+		pkgmiddleware.RedisAPIKeys(redis.Client))
+}
+
+// RequireVerified rejects callers that have not confirmed their email yet.
+func RequireVerified() gin.HandlerFunc {
+	return pkgmiddleware.RequireVerified()
+}
+
+// RequireRole restricts a route to callers holding one of roles.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return pkgmiddleware.RequireRole(roles...)
+}
+
+// RequireScope restricts a route to sessions and to API keys and OAuth app
+// tokens holding one of scopes.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return pkgmiddleware.RequireScope(scopes...)
+}
+
+// ServiceAuth accepts the short-lived tokens Auth mints for its calls to
+// internal endpoints. They never live in Redis, so no revocation check
+// applies; pair it with RequireRole(token.RoleService).
+func ServiceAuth() gin.HandlerFunc {
+	return pkgmiddleware.Auth(validator, nil)
 }
@@ -7,24 +7,39 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"rysto/pkg/purge"
 )
 
 type Story struct {
-	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
-	AuthorID  string              `bson:"authorId" json:"authorId"`
-	Content   string              `bson:"content" json:"content"`
-	Title     string              `bson:"title" json:"title"`
-	CreatedAt time.Time           `bson:"createdAt" json:"createdAt"`
-	Tags	  []string            `bson:"tags,omitempty" json:"tags,omitempty"`
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	AuthorID     string             `bson:"authorId" json:"authorId"`                             // user ID issued by Auth
+	AuthorHandle string             `bson:"authorHandle,omitempty" json:"authorHandle,omitempty"` // current handle, kept up to date by Auth
+	Content      string             `bson:"content" json:"content"`
+	Title        string             `bson:"title" json:"title"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+	Tags         []string           `bson:"tags,omitempty" json:"tags,omitempty"`
+
+	// AcceptedPath is the canonical storyline: the accepted continuations
+	// from the opening down, each one continuing the one before it.
+	AcceptedPath []primitive.ObjectID `bson:"acceptedPath,omitempty" json:"acceptedPath,omitempty"`
 }
 
 type Continuation struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	StoryID   primitive.ObjectID `bson:"storyId" json:"storyId"`
-	AuthorID  string             `bson:"authorId" json:"authorId"`
-	Content   string             `bson:"content" json:"content"`
-	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
-	Accepted  bool               `bson:"accepted" json:"accepted"`
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	StoryID      primitive.ObjectID `bson:"storyId" json:"storyId"`
+	AuthorID     string             `bson:"authorId" json:"authorId"` // user ID issued by Auth
+	AuthorHandle string             `bson:"authorHandle,omitempty" json:"authorHandle,omitempty"`
+	Content      string             `bson:"content" json:"content"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+	Accepted     bool               `bson:"accepted" json:"accepted"`
+
+	// ParentID is the continuation this one continues; nil when it continues
+	// the story's opening. Ancestors runs from the top-level continuation
+	// down to the parent, so a subtree is a single indexed query.
+	ParentID  *primitive.ObjectID  `bson:"parentId,omitempty" json:"parentId,omitempty"`
+	Ancestors []primitive.ObjectID `bson:"ancestors,omitempty" json:"ancestors,omitempty"`
 }
 
 var StoryCollection *mongo.Collection
@@ -39,3 +54,168 @@ func DeleteContinuationsByStoryID(ctx context.Context, storyID primitive.ObjectI
 	_, err := ContinuationCollection.DeleteMany(ctx, bson.M{"storyId": storyID})
 	return err
 }
+
+// SetAuthorHandle records that authorID now goes by handle on every story
+// and continuation they wrote.
+func SetAuthorHandle(ctx context.Context, authorID, handle string) (map[string]int64, error) {
+	update := bson.M{"$set": bson.M{"authorHandle": handle}}
+
+	stories, err := StoryCollection.UpdateMany(ctx, bson.M{"authorId": authorID}, update)
+	if err != nil {
+		return nil, err
+	}
+	continuations, err := ContinuationCollection.UpdateMany(ctx, bson.M{"authorId": authorID}, update)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int64{
+		"storiesUpdated":       stories.ModifiedCount,
+		"continuationsUpdated": continuations.ModifiedCount,
+	}, nil
+}
+
+// AnonymizeAuthor reassigns every story and continuation of authorID to the
+// deleted-user tombstone.
+func AnonymizeAuthor(ctx context.Context, authorID string) (map[string]int64, error) {
+	update := bson.M{"$set": bson.M{"authorId": purge.DeletedUserID, "authorHandle": purge.DeletedUserHandle}}
+
+	stories, err := StoryCollection.UpdateMany(ctx, bson.M{"authorId": authorID}, update)
+	if err != nil {
+		return nil, err
+	}
+	continuations, err := ContinuationCollection.UpdateMany(ctx, bson.M{"authorId": authorID}, update)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int64{
+		"storiesAnonymized":       stories.ModifiedCount,
+		"continuationsAnonymized": continuations.ModifiedCount,
+	}, nil
+}
+
+// DeleteByAuthor removes every story of authorID together with all of its
+// continuations, and every continuation authorID wrote on other stories
+// together with their own continuations threaded below it. A continuation
+// that others continued below is kept, emptied and reassigned to the
+// tombstone user, so their replies stay in place. It also returns the IDs of
+// the removed continuations.
+func DeleteByAuthor(ctx context.Context, authorID string) (map[string]int64, []primitive.ObjectID, error) {
+	ids, err := StoryCollection.Distinct(ctx, "_id", bson.M{"authorId": authorID})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var removed []primitive.ObjectID
+	var onStories []Continuation
+	cursor, err := ContinuationCollection.Find(ctx, bson.M{"storyId": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cursor.All(ctx, &onStories); err != nil {
+		return nil, nil, err
+	}
+	for _, cont := range onStories {
+		removed = append(removed, cont.ID)
+	}
+	if _, err := ContinuationCollection.DeleteMany(ctx, bson.M{"storyId": bson.M{"$in": ids}}); err != nil {
+		return nil, nil, err
+	}
+
+	// What is left is on other stories, whose storylines must not keep
+	// pointing at removed continuations.
+	var others []Continuation
+	cursor, err = ContinuationCollection.Find(ctx, bson.M{"authorId": authorID},
+		options.Find().SetProjection(bson.M{"_id": 1, "storyId": 1}))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cursor.All(ctx, &others); err != nil {
+		return nil, nil, err
+	}
+	var emptied int64
+	for _, cont := range others {
+		replies, err := ContinuationCollection.CountDocuments(ctx,
+			bson.M{"ancestors": cont.ID, "authorId": bson.M{"$ne": authorID}})
+		if err != nil {
+			return nil, nil, err
+		}
+		if replies > 0 {
+			res, err := ContinuationCollection.UpdateOne(ctx, bson.M{"_id": cont.ID}, bson.M{"$set": bson.M{
+				"authorId":     purge.DeletedUserID,
+				"authorHandle": purge.DeletedUserHandle,
+				"content":      "",
+			}})
+			if err != nil {
+				return nil, nil, err
+			}
+			emptied += res.ModifiedCount
+			continue
+		}
+
+		subtree, err := Subtree(ctx, cont.StoryID, cont.ID)
+		if err == mongo.ErrNoDocuments {
+			// Removed already when an earlier one was its ancestor.
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := DeleteSubtree(ctx, cont.StoryID, cont.ID); err != nil {
+			return nil, nil, err
+		}
+		for _, sub := range subtree {
+			removed = append(removed, sub.ID)
+		}
+	}
+
+	stories, err := StoryCollection.DeleteMany(ctx, bson.M{"authorId": authorID})
+	if err != nil {
+		return nil, nil, err
+	}
+	return map[string]int64{
+		"storiesDeleted":       stories.DeletedCount,
+		"continuationsDeleted": int64(len(removed)),
+		"continuationsEmptied": emptied,
+	}, removed, nil
+}
+
+// FindByAuthor returns every story and continuation written by authorID.
+func FindByAuthor(ctx context.Context, authorID string) ([]Story, []Continuation, error) {
+	stories := []Story{}
+	cursor, err := StoryCollection.Find(ctx, bson.M{"authorId": authorID})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cursor.All(ctx, &stories); err != nil {
+		return nil, nil, err
+	}
+
+	continuations := []Continuation{}
+	cursor, err = ContinuationCollection.Find(ctx, bson.M{"authorId": authorID})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cursor.All(ctx, &continuations); err != nil {
+		return nil, nil, err
+	}
+	return stories, continuations, nil
+}
+
+// StoryTitles maps the given story IDs to their titles.
+func StoryTitles(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	cursor, err := StoryCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var stories []Story
+	if err := cursor.All(ctx, &stories); err != nil {
+		return nil, err
+	}
+
+	titles := make(map[primitive.ObjectID]string, len(stories))
+	for _, s := range stories {
+		titles[s.ID] = s.Title
+	}
+	return titles, nil
+}
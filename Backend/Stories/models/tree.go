@@ -0,0 +1,186 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ContinuationNode is a continuation with the continuations that continue
+// it, oldest first.
+type ContinuationNode struct {
+	Continuation
+	Children []*ContinuationNode `json:"children"`
+}
+
+// EnsureIndexes creates the indexes the continuation tree is read through.
+func EnsureIndexes(ctx context.Context) error {
+	_, err := ContinuationCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "storyId", Value: 1}, {Key: "createdAt", Value: 1}}},
+		{Keys: bson.D{{Key: "ancestors", Value: 1}}},
+	})
+	return err
+}
+
+// BackfillAcceptedPaths turns the single continuation stories accepted
+// before threads existed into a one-step canonical storyline.
+func BackfillAcceptedPaths(ctx context.Context) (int64, error) {
+	res, err := StoryCollection.UpdateMany(ctx,
+		bson.M{"accepted": bson.M{"$type": "objectId"}, "acceptedPath": bson.M{"$exists": false}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"acceptedPath": bson.A{"$accepted"}}}},
+			{{Key: "$unset", Value: "accepted"}},
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+var (
+	ErrAlreadyAccepted = errors.New("continuation is already on the storyline")
+	ErrNotOnStoryline  = errors.New("continuation does not continue the storyline")
+)
+
+// ExtendPath returns the story's accepted path with cont accepted. cont must
+// continue the opening or a continuation on the path; whatever the path held
+// below that point is replaced by cont. Accepting a continuation that is
+// already on the path is refused, so it cannot cut off what follows it.
+func (s *Story) ExtendPath(cont *Continuation) ([]primitive.ObjectID, error) {
+	for _, id := range s.AcceptedPath {
+		if id == cont.ID {
+			return nil, ErrAlreadyAccepted
+		}
+	}
+	if cont.ParentID == nil {
+		return []primitive.ObjectID{cont.ID}, nil
+	}
+	for i, id := range s.AcceptedPath {
+		if id == *cont.ParentID {
+			path := append([]primitive.ObjectID{}, s.AcceptedPath[:i+1]...)
+			return append(path, cont.ID), nil
+		}
+	}
+	return nil, ErrNotOnStoryline
+}
+
+// Subtree returns continuation id of storyID and every continuation below
+// it, oldest first. It returns mongo.ErrNoDocuments when id does not exist.
+func Subtree(ctx context.Context, storyID, id primitive.ObjectID) ([]Continuation, error) {
+	cursor, err := ContinuationCollection.Find(ctx,
+		bson.M{"storyId": storyID, "$or": bson.A{bson.M{"_id": id}, bson.M{"ancestors": id}}},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var continuations []Continuation
+	if err := cursor.All(ctx, &continuations); err != nil {
+		return nil, err
+	}
+	for _, cont := range continuations {
+		if cont.ID == id {
+			return continuations, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+// BuildTree arranges continuations, as returned by Subtree, under the one
+// with rootID. A continuation whose parent has been removed hangs under its
+// nearest remaining ancestor.
+func BuildTree(rootID primitive.ObjectID, continuations []Continuation) *ContinuationNode {
+	nodes := make(map[primitive.ObjectID]*ContinuationNode, len(continuations))
+	for _, cont := range continuations {
+		nodes[cont.ID] = &ContinuationNode{Continuation: cont, Children: []*ContinuationNode{}}
+	}
+	root := nodes[rootID]
+	if root == nil {
+		return nil
+	}
+
+	for _, cont := range continuations {
+		if cont.ID == rootID {
+			continue
+		}
+		for i := len(cont.Ancestors) - 1; i >= 0; i-- {
+			if parent, ok := nodes[cont.Ancestors[i]]; ok {
+				parent.Children = append(parent.Children, nodes[cont.ID])
+				break
+			}
+		}
+	}
+	return root
+}
+
+// Path returns the continuations from the top-level one down to continuation
+// id of storyID. Removed ancestors are left out. It returns
+// mongo.ErrNoDocuments when id does not exist.
+func Path(ctx context.Context, storyID, id primitive.ObjectID) ([]Continuation, error) {
+	var leaf Continuation
+	if err := ContinuationCollection.FindOne(ctx, bson.M{"_id": id, "storyId": storyID}).Decode(&leaf); err != nil {
+		return nil, err
+	}
+	if len(leaf.Ancestors) == 0 {
+		return []Continuation{leaf}, nil
+	}
+
+	cursor, err := ContinuationCollection.Find(ctx, bson.M{"_id": bson.M{"$in": leaf.Ancestors}})
+	if err != nil {
+		return nil, err
+	}
+	var ancestors []Continuation
+	if err := cursor.All(ctx, &ancestors); err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]Continuation, len(ancestors))
+	for _, cont := range ancestors {
+		byID[cont.ID] = cont
+	}
+
+	path := make([]Continuation, 0, len(leaf.Ancestors)+1)
+	for _, ancestorID := range leaf.Ancestors {
+		if cont, ok := byID[ancestorID]; ok {
+			path = append(path, cont)
+		}
+	}
+	return append(path, leaf), nil
+}
+
+// DeleteSubtree removes continuation id of storyID with everything below it
+// and cuts the story's accepted path short where it ran through them: every
+// entry after id on the path lies below id, so cutting at id removes exactly
+// the removed continuations. It returns how many continuations were removed.
+func DeleteSubtree(ctx context.Context, storyID, id primitive.ObjectID) (int64, error) {
+	res, err := ContinuationCollection.DeleteMany(ctx,
+		bson.M{"storyId": storyID, "$or": bson.A{bson.M{"_id": id}, bson.M{"ancestors": id}}})
+	if err != nil || res.DeletedCount == 0 {
+		return 0, err
+	}
+
+	var story Story
+	err = StoryCollection.FindOne(ctx, bson.M{"_id": storyID, "acceptedPath": id}).Decode(&story)
+	if err == mongo.ErrNoDocuments {
+		return res.DeletedCount, nil
+	}
+	if err != nil {
+		return res.DeletedCount, err
+	}
+	for i, pathID := range story.AcceptedPath {
+		if pathID != id {
+			continue
+		}
+		update := bson.M{"$set": bson.M{"acceptedPath": story.AcceptedPath[:i]}}
+		if i == 0 {
+			update = bson.M{"$unset": bson.M{"acceptedPath": ""}}
+		}
+		_, err = StoryCollection.UpdateOne(ctx, bson.M{"_id": storyID}, update)
+		break
+	}
+	return res.DeletedCount, err
+}
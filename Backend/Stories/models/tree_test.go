@@ -0,0 +1,176 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ids returns n fresh, distinct object IDs.
+func ids(n int) []primitive.ObjectID {
+	out := make([]primitive.ObjectID, n)
+	for i := range out {
+		out[i] = primitive.NewObjectID()
+	}
+	return out
+}
+
+func TestExtendPath(t *testing.T) {
+	id := ids(6)
+	a, b, c, d, e, stray := id[0], id[1], id[2], id[3], id[4], id[5]
+
+	tests := []struct {
+		name    string
+		path    []primitive.ObjectID
+		cont    Continuation
+		want    []primitive.ObjectID
+		wantErr error
+	}{
+		{
+			name: "first continuation of the opening",
+			cont: Continuation{ID: a},
+			want: []primitive.ObjectID{a},
+		},
+		{
+			name: "continues the tip",
+			path: []primitive.ObjectID{a, b},
+			cont: Continuation{ID: c, ParentID: &b, Ancestors: []primitive.ObjectID{a, b}},
+			want: []primitive.ObjectID{a, b, c},
+		},
+		{
+			name: "branches off the middle and replaces the tail",
+			path: []primitive.ObjectID{a, b, c},
+			cont: Continuation{ID: d, ParentID: &a, Ancestors: []primitive.ObjectID{a}},
+			want: []primitive.ObjectID{a, d},
+		},
+		{
+			name: "new top-level continuation replaces the whole path",
+			path: []primitive.ObjectID{a, b},
+			cont: Continuation{ID: e},
+			want: []primitive.ObjectID{e},
+		},
+		{
+			name:    "already on the path",
+			path:    []primitive.ObjectID{a, b, c},
+			cont:    Continuation{ID: b, ParentID: &a, Ancestors: []primitive.ObjectID{a}},
+			wantErr: ErrAlreadyAccepted,
+		},
+		{
+			name:    "top-level continuation already on the path",
+			path:    []primitive.ObjectID{a, b},
+			cont:    Continuation{ID: a},
+			wantErr: ErrAlreadyAccepted,
+		},
+		{
+			name:    "parent off the path",
+			path:    []primitive.ObjectID{a, b},
+			cont:    Continuation{ID: e, ParentID: &stray, Ancestors: []primitive.ObjectID{a, stray}},
+			wantErr: ErrNotOnStoryline,
+		},
+		{
+			name:    "parent with an empty path",
+			cont:    Continuation{ID: c, ParentID: &b, Ancestors: []primitive.ObjectID{a, b}},
+			wantErr: ErrNotOnStoryline,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			story := Story{AcceptedPath: append([]primitive.ObjectID(nil), tt.path...)}
+			got, err := story.ExtendPath(&tt.cont)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("path = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(story.AcceptedPath, tt.path) {
+				t.Errorf("story path modified to %v", story.AcceptedPath)
+			}
+		})
+	}
+}
+
+// shape renders a tree as parent -> children IDs, for comparison.
+func shape(n *ContinuationNode, out map[primitive.ObjectID][]primitive.ObjectID) {
+	for _, child := range n.Children {
+		out[n.ID] = append(out[n.ID], child.ID)
+		shape(child, out)
+	}
+}
+
+func TestBuildTree(t *testing.T) {
+	id := ids(6)
+	a, b, c, d, e, gone := id[0], id[1], id[2], id[3], id[4], id[5]
+
+	tests := []struct {
+		name  string
+		root  primitive.ObjectID
+		conts []Continuation
+		want  map[primitive.ObjectID][]primitive.ObjectID // nil: no tree
+	}{
+		{
+			name:  "single node",
+			root:  a,
+			conts: []Continuation{{ID: a}},
+			want:  map[primitive.ObjectID][]primitive.ObjectID{},
+		},
+		{
+			name: "children keep their order",
+			root: a,
+			conts: []Continuation{
+				{ID: a},
+				{ID: b, ParentID: &a, Ancestors: []primitive.ObjectID{a}},
+				{ID: c, ParentID: &a, Ancestors: []primitive.ObjectID{a}},
+				{ID: d, ParentID: &b, Ancestors: []primitive.ObjectID{a, b}},
+			},
+			want: map[primitive.ObjectID][]primitive.ObjectID{a: {b, c}, b: {d}},
+		},
+		{
+			name: "subtree below a nested root",
+			root: b,
+			conts: []Continuation{
+				{ID: b, ParentID: &a, Ancestors: []primitive.ObjectID{a}},
+				{ID: d, ParentID: &b, Ancestors: []primitive.ObjectID{a, b}},
+				{ID: e, ParentID: &d, Ancestors: []primitive.ObjectID{a, b, d}},
+			},
+			want: map[primitive.ObjectID][]primitive.ObjectID{b: {d}, d: {e}},
+		},
+		{
+			name: "orphan hangs under its nearest remaining ancestor",
+			root: a,
+			conts: []Continuation{
+				{ID: a},
+				{ID: c, ParentID: &gone, Ancestors: []primitive.ObjectID{a, gone}},
+				{ID: d, ParentID: &c, Ancestors: []primitive.ObjectID{a, gone, c}},
+			},
+			want: map[primitive.ObjectID][]primitive.ObjectID{a: {c}, c: {d}},
+		},
+		{
+			name:  "root missing",
+			root:  gone,
+			conts: []Continuation{{ID: a}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := BuildTree(tt.root, tt.conts)
+			if tt.want == nil {
+				if tree != nil {
+					t.Fatalf("tree = %+v, want nil", tree)
+				}
+				return
+			}
+			if tree == nil || tree.ID != tt.root {
+				t.Fatalf("tree root = %+v, want %v", tree, tt.root)
+			}
+			got := map[primitive.ObjectID][]primitive.ObjectID{}
+			shape(tree, got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tree = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,51 +0,0 @@
-package utils
-
-import (
-	"strings"
-	"time"
-
-	"github.com/golang-jwt/jwt/v4"
-)
-
-var jwtKey []byte
-
-func SetJWTSecret(secret []byte) {
-	jwtKey = secret
-}
-
-type Claims struct {
-	Email string `json:"email"`
-	jwt.RegisteredClaims
-}
-
-func GenerateToken(email string) (string, error) {
-	expiration := time.Now().Add(72 * time.Hour)
-	claims := &Claims{
-		Email: email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiration),
-			IssuedAt: jwt.NewNumericDate(time.Now()),
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
-}
-
-func ValidateToken(tokenStr string) (*Claims, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-	if err != nil || !token.Valid {
-		return nil, err
-	}
-	return claims, nil
-}
-
-func ExtractToken(header string) string {
-	parts := strings.Split(header, " ")
-	if len(parts) == 2 && parts[0] == "Bearer" {
-		return parts[1]
-	}
-	return ""
-}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"votingService.com/voting/metrics"
+	"votingService.com/voting/models"
+
+	"rysto/pkg/purge"
+	"rysto/pkg/takeout"
+)
+
+// PurgeUser anonymizes or removes the votes of a deleted account, and removes
+// the votes on the continuations Stories removed with it. Called by Auth with
+// a service token; safe to repeat.
+func PurgeUser(c *gin.Context) {
+	start := time.Now()
+
+	var req purge.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		metrics.HttpRequests.WithLabelValues("/internal/users/:id/purge", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	voterID := c.Param("id")
+	removed := make([]primitive.ObjectID, 0, len(req.RemovedContinuations))
+	for _, hex := range req.RemovedContinuations {
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/internal/users/:id/purge", "400").Inc()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid continuation ID"})
+			return
+		}
+		removed = append(removed, id)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	counts := map[string]int64{}
+	if req.Mode == purge.ModeDelete {
+		n, err := models.DeleteVotesByVoter(ctx, voterID)
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/internal/users/:id/purge", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete votes"})
+			return
+		}
+		counts["votesDeleted"] = n
+		metrics.VotesDeleted.Add(float64(n))
+		metrics.ActiveVotes.Sub(float64(n))
+	} else {
+		n, err := models.AnonymizeVoter(ctx, voterID)
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/internal/users/:id/purge", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to anonymize votes"})
+			return
+		}
+		counts["votesAnonymized"] = n
+	}
+
+	// Votes on continuations Stories removed in this purge, by anyone.
+	if len(removed) > 0 {
+		n, err := models.DeleteVotesOnContinuations(ctx, removed)
+		if err != nil {
+			metrics.HttpRequests.WithLabelValues("/internal/users/:id/purge", "500").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete votes"})
+			return
+		}
+		counts["votesOnRemovedContinuationsDeleted"] = n
+		metrics.VotesDeleted.Add(float64(n))
+		metrics.ActiveVotes.Sub(float64(n))
+	}
+
+	metrics.HttpRequests.WithLabelValues("/internal/users/:id/purge", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/internal/users/:id/purge").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, purge.Report{Service: "voting", Mode: req.Mode, Counts: counts})
+}
+
+// ExportUser returns every vote a user cast, for Auth's data export.
+func ExportUser(c *gin.Context) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	votes, err := models.GetVotesByVoter(ctx, c.Param("id"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/internal/users/:id/export", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch votes"})
+		return
+	}
+
+	export := takeout.VotesExport{Votes: make([]takeout.Vote, 0, len(votes))}
+	for _, v := range votes {
+		export.Votes = append(export.Votes, takeout.Vote{
+			ContinuationID: v.ContinuationID.Hex(),
+			VotedAt:        v.VotedAt,
+		})
+	}
+
+	metrics.HttpRequests.WithLabelValues("/internal/users/:id/export", "200").Inc()
+	metrics.HttpRequestDuration.WithLabelValues("/internal/users/:id/export").Observe(time.Since(start).Seconds())
+	c.JSON(http.StatusOK, export)
+}
@@ -14,7 +14,7 @@ import (
 
 func CreateVote(c *gin.Context) {
 	start := time.Now()
-	email, _ := c.Get("email")
+	voterID := c.GetString("userId")
 	continuationId := c.Param("continuationId")
 	objID, err := primitive.ObjectIDFromHex(continuationId)
 	if err != nil {
@@ -25,7 +25,7 @@ func CreateVote(c *gin.Context) {
 
 	vote := models.Vote{
 		ContinuationID: objID,
-		VoterEmail:     email.(string),
+		VoterID:        voterID,
 		VotedAt:        time.Now(),
 	}
 
@@ -73,7 +73,7 @@ func GetVotesByContinuation(c *gin.Context) {
 
 func DeleteVote(c *gin.Context) {
 	start := time.Now()
-	email, _ := c.Get("email")
+	voterID := c.GetString("userId")
 	continuationId := c.Param("continuationId")
 	objID, err := primitive.ObjectIDFromHex(continuationId)
 	if err != nil {
@@ -85,7 +85,7 @@ func DeleteVote(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := models.DeleteVote(ctx, objID, email.(string)); err != nil {
+	if _, err := models.DeleteVote(ctx, objID, voterID); err != nil {
 		metrics.HttpRequests.WithLabelValues("/api/votes/:continuationId", "500").Inc()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vote"})
 		return
@@ -98,3 +98,38 @@ func DeleteVote(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Vote deleted"})
 }
+
+// ModerateDeleteVote removes another user's vote on a continuation, e.g. one
+// cast by a sock puppet account. Routed behind the moderator role.
+func ModerateDeleteVote(c *gin.Context) {
+	start := time.Now()
+	continuationId := c.Param("continuationId")
+	objID, err := primitive.ObjectIDFromHex(continuationId)
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/api/votes/:continuationId/voters/:voter", "400").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid continuation ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := models.DeleteVote(ctx, objID, c.Param("voter"))
+	if err != nil {
+		metrics.HttpRequests.WithLabelValues("/api/votes/:continuationId/voters/:voter", "500").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vote"})
+		return
+	}
+	if deleted == 0 {
+		metrics.HttpRequests.WithLabelValues("/api/votes/:continuationId/voters/:voter", "404").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return
+	}
+
+	metrics.HttpRequests.WithLabelValues("/api/votes/:continuationId/voters/:voter", "200").Inc()
+	metrics.VotesDeleted.Inc()
+	metrics.ActiveVotes.Dec()
+	metrics.HttpRequestDuration.WithLabelValues("/api/votes/:continuationId/voters/:voter").Observe(time.Since(start).Seconds())
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote removed by moderator"})
+}
@@ -14,8 +14,12 @@ import (
 	"votingService.com/voting/controllers"
 	"votingService.com/voting/middleware"
 	"votingService.com/voting/models"
-	"votingService.com/voting/utils"
 	"votingService.com/voting/metrics"
+
+	"rysto/pkg/introspect"
+	"rysto/pkg/redis"
+	"rysto/pkg/token"
+	"rysto/pkg/userstatus"
 )
 
 func main() {
@@ -29,11 +33,35 @@ func main() {
 	if mongoURI == "" {
 		log.Fatal("MONGODB_URI not set")
 	}
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET not set")
+	validator, err := token.ValidatorFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	middleware.SetValidator(validator)
+
+	// With AUTH_INTROSPECT_URL set, Auth is asked whether tokens are still
+	// valid and Redis is optional.
+	introspector, err := introspect.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if introspector != nil {
+		middleware.SetIntrospector(introspector)
+		log.Println("Checking tokens through Auth's introspection endpoint")
+		// Cached verdicts are dropped as Auth announces suspensions and
+		// bans; with no Redis to hear them on, nothing is cached.
+		if os.Getenv("REDIS_ADDR") != "" {
+			redis.InitRedis()
+			go userstatus.Watch(context.Background(), redis.Client, introspector.Evict)
+		} else {
+			introspector.DisableCache()
+			log.Println("REDIS_ADDR not set: introspection verdicts are not cached")
+		}
+	} else {
+		log.Println("Connecting to Redis...")
+		redis.InitRedis()
+		log.Println("Redis connected successfully!")
 	}
-	utils.SetJWTSecret([]byte(jwtSecret))
 
 	log.Println("Connecting to MongoDB...")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -50,12 +78,25 @@ func main() {
 	r.Use(metrics.PrometheusMiddleware())   // ✅ add middleware
 	metrics.RegisterMetricsEndpoint(r)      // ✅ expose /metrics
 
+	// API keys and tokens of third-party OAuth apps only reach the routes
+	// their scopes allow; session tokens are unrestricted.
+	read := middleware.RequireScope(token.ScopeVotesRead)
+	write := middleware.RequireScope(token.ScopeVotesWrite)
+
 	api := r.Group("/api/votes")
 	api.Use(middleware.AuthMiddleware())
 	{
-		api.POST("/:continuationId", controllers.CreateVote)
-		api.GET("/:continuationId", controllers.GetVotesByContinuation)
-		api.DELETE("/:continuationId", controllers.DeleteVote)
+		api.POST("/:continuationId", write, middleware.RequireVerified(), controllers.CreateVote)
+		api.GET("/:continuationId", read, controllers.GetVotesByContinuation)
+		api.DELETE("/:continuationId", write, controllers.DeleteVote)
+		api.DELETE("/:continuationId/voters/:voter", middleware.RequireRole(token.RoleModerator), controllers.ModerateDeleteVote)
+	}
+
+	internal := r.Group("/internal")
+	internal.Use(middleware.ServiceAuth(), middleware.RequireRole(token.RoleService))
+	{
+		internal.POST("/users/:id/purge", controllers.PurgeUser)
+		internal.GET("/users/:id/export", controllers.ExportUser)
 	}
 
 	log.Printf("Voting service running on port %s", port)
@@ -4,11 +4,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"time"
-	"net/http"
+
+	pkgmetrics "rysto/pkg/metrics"
 )
 
+var httpMetrics = pkgmetrics.NewHTTPMetrics("")
+
 // --- Business Metrics ---
 var (
 	// Count of total votes cast
@@ -36,39 +37,18 @@ var (
 	)
 
 	// Tracks HTTP requests
-	HttpRequests = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total HTTP requests labeled by endpoint and status",
-		},
-		[]string{"endpoint", "status"},
-	)
+	HttpRequests = httpMetrics.Requests
 
 	// Latency histogram
-	HttpRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "Request latency distribution",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"endpoint"},
-	)
+	HttpRequestDuration = httpMetrics.Duration
 )
 
 // --- Middleware ---
 func PrometheusMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		start := time.Now()
-		c.Next()
-		duration := time.Since(start).Seconds()
-		status := http.StatusText(c.Writer.Status())
-
-		HttpRequests.WithLabelValues(c.FullPath(), status).Inc()
-		HttpRequestDuration.WithLabelValues(c.FullPath()).Observe(duration)
-	}
+	return httpMetrics.Middleware()
 }
 
 // --- Expose metrics endpoint ---
 func RegisterMetricsEndpoint(r *gin.Engine) {
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/metrics", pkgmetrics.Handler())
 }
@@ -1,37 +1,71 @@
 package middleware
 
 import (
-	"net/http"
-	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"votingService.com/voting/utils"
+
+	"rysto/pkg/introspect"
+	pkgmiddleware "rysto/pkg/middleware"
+	"rysto/pkg/redis"
+	"rysto/pkg/token"
+)
+
+// tokenCacheTTL bounds how long a token revoked through Auth's Logout can
+// keep working here. Suspensions and bans evict cached tokens at once.
+const tokenCacheTTL = 15 * time.Second
+
+var (
+	validator    *token.Validator
+	introspector *introspect.Client
 )
 
+// SetValidator configures the validator for tokens issued by the Auth service.
+func SetValidator(v *token.Validator) {
+	validator = v
+}
+
+// SetIntrospector makes AuthMiddleware ask Auth's /introspect about tokens
+// and API keys instead of reading Redis.
+func SetIntrospector(client *introspect.Client) {
+	introspector = client
+}
+
+// AuthMiddleware accepts tokens that Auth signed and still keeps in Redis, and
+// API keys Auth issued, unless their owner is suspended or banned. Positive
+// token lookups are cached briefly so every vote does not cost a Redis round
+// trip, and dropped when the owner's status changes. With an introspector
+// set, Auth is asked instead and the introspector does the caching. Routes
+// restrict keys further with RequireScope.
 func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
-			return
-		}
-
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
-			c.Abort()
-			return
-		}
-
-		token := parts[1]
-		claims, err := utils.ValidateToken(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
-			return
-		}
-		c.Set("email", claims.Email)
-		c.Next()
+	if introspector != nil {
+		return pkgmiddleware.AuthWithAPIKeys(validator,
+			pkgmiddleware.IntrospectionCheck(introspector),
+			pkgmiddleware.IntrospectedAPIKeys(introspector))
 	}
+	check := pkgmiddleware.CachedCheck(pkgmiddleware.RedisTokenCheck(redis.Client), tokenCacheTTL, redis.Client)
+	return pkgmiddleware.AuthWithAPIKeys(validator, check, pkgmiddleware.RedisAPIKeys(redis.Client))
+}
+
+// RequireVerified rejects callers that have not confirmed their email yet.
+func RequireVerified() gin.HandlerFunc {
+	return pkgmiddleware.RequireVerified()
+}
+
+// RequireRole restricts a route to callers holding one of roles.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return pkgmiddleware.RequireRole(roles...)
+}
+
+// RequireScope restricts a route to sessions and to API keys and OAuth app
+// tokens holding one of scopes.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return pkgmiddleware.RequireScope(scopes...)
+}
+
+// ServiceAuth accepts the short-lived tokens Auth mints for its calls to
+// internal endpoints. They never live in Redis, so no revocation check
+// applies; pair it with RequireRole(token.RoleService).
+func ServiceAuth() gin.HandlerFunc {
+	return pkgmiddleware.Auth(validator, nil)
 }
@@ -7,12 +7,14 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+
+	"rysto/pkg/purge"
 )
 
 type Vote struct {
 	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	ContinuationID primitive.ObjectID `bson:"continuationId" json:"continuationId"`
-	VoterEmail     string             `bson:"voterEmail" json:"voterEmail"`
+	VoterID        string             `bson:"voterId" json:"voterId"` // user ID issued by Auth
 	VotedAt        time.Time          `bson:"votedAt" json:"votedAt"`
 }
 
@@ -39,10 +41,60 @@ func GetVotesByContinuation(ctx context.Context, continuationID primitive.Object
 	return votes, nil
 }
 
-func DeleteVote(ctx context.Context, continuationID primitive.ObjectID, email string) error {
-	_, err := voteCollection.DeleteOne(ctx, bson.M{
+// DeleteVote removes voterID's vote on a continuation and returns how many
+// votes were removed: 0 or 1.
+func DeleteVote(ctx context.Context, continuationID primitive.ObjectID, voterID string) (int64, error) {
+	res, err := voteCollection.DeleteOne(ctx, bson.M{
 		"continuationId": continuationID,
-		"voterEmail":     email,
+		"voterId":        voterID,
 	})
-	return err
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// AnonymizeVoter reassigns every vote of voterID to the deleted-user
+// tombstone, keeping the tallies intact.
+func AnonymizeVoter(ctx context.Context, voterID string) (int64, error) {
+	res, err := voteCollection.UpdateMany(ctx,
+		bson.M{"voterId": voterID},
+		bson.M{"$set": bson.M{"voterId": purge.DeletedUserID}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// DeleteVotesByVoter removes every vote of voterID.
+func DeleteVotesByVoter(ctx context.Context, voterID string) (int64, error) {
+	res, err := voteCollection.DeleteMany(ctx, bson.M{"voterId": voterID})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// DeleteVotesOnContinuations removes every vote on the given continuations,
+// whoever cast it.
+func DeleteVotesOnContinuations(ctx context.Context, continuationIDs []primitive.ObjectID) (int64, error) {
+	res, err := voteCollection.DeleteMany(ctx, bson.M{"continuationId": bson.M{"$in": continuationIDs}})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// GetVotesByVoter returns every vote cast by voterID.
+func GetVotesByVoter(ctx context.Context, voterID string) ([]Vote, error) {
+	cursor, err := voteCollection.Find(ctx, bson.M{"voterId": voterID})
+	if err != nil {
+		return nil, err
+	}
+	var votes []Vote
+	if err = cursor.All(ctx, &votes); err != nil {
+		return nil, err
+	}
+	return votes, nil
 }
@@ -0,0 +1,74 @@
+// Package apikey resolves the personal API keys Auth issues. Auth owns the
+// keys; every service looks them up in Redis by digest.
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Prefix starts every API key, so leaked keys are easy to recognise and
+// cannot be mistaken for JWTs.
+const Prefix = "rysto_"
+
+var ErrNotFound = errors.New("api key not found")
+
+// Principal is the account and scopes an API key acts for.
+type Principal struct {
+	KeyID  string
+	UserID string
+	Handle string
+	Scopes []string
+}
+
+// Redis layout (written by Auth):
+//
+//	apikey:<sha256 of key> hash {id, user, handle, scopes}
+//	apikeys:last_used      hash key ID -> unix seconds of the last request
+//
+// Only the digest of a key is ever stored.
+
+// Hash returns the hex SHA-256 digest of key.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// LastUsedKey is the hash recording when each key was last used.
+const LastUsedKey = "apikeys:last_used"
+
+// LookupKey returns the Redis key holding the key with the given digest.
+func LookupKey(hash string) string { return "apikey:" + hash }
+
+// Resolve looks up key and records that it was used.
+func Resolve(ctx context.Context, client *goredis.Client, key string) (*Principal, error) {
+	if !strings.HasPrefix(key, Prefix) {
+		return nil, ErrNotFound
+	}
+	lookup := LookupKey(Hash(key))
+
+	fields, err := client.HGetAll(ctx, lookup).Result()
+	if err != nil {
+		return nil, err
+	}
+	if fields["id"] == "" || fields["user"] == "" || fields["scopes"] == "" {
+		return nil, ErrNotFound
+	}
+
+	// Failing to record the timestamp must not fail the request.
+	client.HSet(ctx, LastUsedKey, fields["id"], strconv.FormatInt(time.Now().Unix(), 10))
+
+	return &Principal{
+		KeyID:  fields["id"],
+		UserID: fields["user"],
+		Handle: fields["handle"],
+		Scopes: strings.Fields(fields["scopes"]),
+	}, nil
+}
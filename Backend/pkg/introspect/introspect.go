@@ -0,0 +1,225 @@
+// Package introspect lets a service ask Auth whether a token or API key is
+// still good through POST /introspect, instead of reading Auth's Redis keys
+// itself.
+package introspect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"rysto/pkg/token"
+	"rysto/pkg/userstatus"
+)
+
+// Statuses of an introspected credential.
+const (
+	StatusActive  = "active"
+	StatusExpired = "expired"
+	StatusRevoked = "revoked"
+	StatusInvalid = "invalid" // not signed by Auth, or an unknown API key
+
+	// The credential is good but its owner is suspended or banned.
+	StatusSuspended = userstatus.Suspended
+	StatusBanned    = userstatus.Banned
+)
+
+// Request is the body of POST /introspect.
+type Request struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// Response is Auth's verdict. Claims are only sent for active credentials;
+// for API keys they carry the key's scopes and KeyID is set. Restriction is
+// sent with the suspended and banned statuses.
+type Response struct {
+	Active      bool               `json:"active"`
+	Status      string             `json:"status"`
+	Claims      *token.Claims      `json:"claims,omitempty"`
+	KeyID       string             `json:"keyId,omitempty"`
+	Restriction *userstatus.Status `json:"restriction,omitempty"`
+}
+
+// DefaultCacheTTL bounds how long a revoked credential keeps working at a
+// service that introspects.
+const DefaultCacheTTL = 15 * time.Second
+
+// maxCacheEntries caps the cache. Once it is full, expired entries are swept
+// and, if that is not enough, live ones dropped at random.
+const maxCacheEntries = 1024
+
+// Client calls Auth's introspection endpoint and caches active verdicts for a
+// short TTL, so a hot token costs one call per TTL rather than one per
+// request. Inactive verdicts and failed calls are never cached.
+type Client struct {
+	url    string
+	secret string
+	ttl    time.Duration
+	http   *http.Client
+
+	mu      sync.Mutex
+	entries map[string]entry
+	gen     uint64 // counts evictions, so a verdict that raced one is not cached
+}
+
+type entry struct {
+	resp    *Response
+	expires time.Time
+}
+
+// New returns a client posting to url, the full address of Auth's
+// /introspect, and authenticating with the shared secret.
+func New(url, secret string, ttl time.Duration) *Client {
+	return &Client{
+		url:     url,
+		secret:  secret,
+		ttl:     ttl,
+		http:    &http.Client{Timeout: 5 * time.Second},
+		entries: make(map[string]entry),
+	}
+}
+
+// FromEnv builds a client from AUTH_INTROSPECT_URL, INTROSPECTION_SECRET and
+// the optional INTROSPECTION_CACHE_TTL (a Go duration). It returns nil when
+// AUTH_INTROSPECT_URL is unset, meaning the service should keep reading
+// Redis directly.
+func FromEnv() (*Client, error) {
+	url := strings.TrimSpace(os.Getenv("AUTH_INTROSPECT_URL"))
+	if url == "" {
+		return nil, nil
+	}
+	secret := os.Getenv("INTROSPECTION_SECRET")
+	if secret == "" {
+		return nil, errors.New("INTROSPECTION_SECRET must be set with AUTH_INTROSPECT_URL")
+	}
+	ttl := DefaultCacheTTL
+	if v := os.Getenv("INTROSPECTION_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid INTROSPECTION_CACHE_TTL %q", v)
+		}
+		ttl = d
+	}
+	return New(url, secret, ttl), nil
+}
+
+// Introspect returns Auth's verdict on raw, from the cache when it is fresh.
+func (c *Client) Introspect(ctx context.Context, raw string) (*Response, error) {
+	if resp, ok := c.cached(raw); ok {
+		return resp, nil
+	}
+	gen := c.generation()
+
+	body, _ := json.Marshal(Request{Token: raw})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.secret)
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection: unexpected status %d", res.StatusCode)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("introspection: %v", err)
+	}
+	if resp.Active && (resp.Claims == nil || resp.Claims.Subject == "") {
+		return nil, errors.New("introspection: active verdict without a subject")
+	}
+
+	c.store(raw, &resp, gen)
+	return &resp, nil
+}
+
+func (c *Client) cached(raw string) (*Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[raw]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, raw)
+		return nil, false
+	}
+	return e.resp, true
+}
+
+func (c *Client) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+func (c *Client) store(raw string, resp *Response, gen uint64) {
+	// Inactive verdicts are not kept: anyone can send made-up keys, and
+	// they would crowd out the live credentials.
+	if !resp.Active {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl <= 0 || gen != c.gen {
+		return
+	}
+	now := time.Now()
+	if len(c.entries) >= maxCacheEntries {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	// Still full of live entries: drop random ones, which costs their
+	// owners no more than a call to Auth.
+	for k := range c.entries {
+		if len(c.entries) < maxCacheEntries {
+			break
+		}
+		delete(c.entries, k)
+	}
+	c.entries[raw] = entry{resp: resp, expires: now.Add(c.ttl)}
+}
+
+// Evict forgets the cached verdicts on userID's credentials, or every verdict
+// when userID is empty. Pass it to userstatus.Watch so suspensions and bans
+// apply at once rather than when the cache runs out.
+func (c *Client) Evict(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	for k, e := range c.entries {
+		if userID == "" || e.resp.Claims.Subject == userID {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// DisableCache makes every Introspect call ask Auth, for services that cannot
+// watch for status changes.
+func (c *Client) DisableCache() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ttl = 0
+	c.entries = make(map[string]entry)
+}
@@ -0,0 +1,176 @@
+package introspect
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"rysto/pkg/token"
+)
+
+// fakeAuth answers /introspect: "live:<user>" is active for user, anything
+// else is invalid, and "fail" is a server error. It counts calls per token.
+type fakeAuth struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (f *fakeAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	f.calls[req.Token]++
+	f.mu.Unlock()
+
+	if req.Token == "fail" {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp := Response{Status: StatusInvalid}
+	if user, ok := strings.CutPrefix(req.Token, "live:"); ok {
+		resp = Response{Active: true, Status: StatusActive, Claims: &token.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: user},
+		}}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (f *fakeAuth) count(raw string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[raw]
+}
+
+func newTestClient(t *testing.T, ttl time.Duration) (*Client, *fakeAuth) {
+	t.Helper()
+	auth := &fakeAuth{calls: make(map[string]int)}
+	srv := httptest.NewServer(auth)
+	t.Cleanup(srv.Close)
+	return New(srv.URL, "secret", ttl), auth
+}
+
+func introspectTimes(t *testing.T, c *Client, raw string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		c.Introspect(context.Background(), raw)
+	}
+}
+
+func TestClientCaching(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		raw       string
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "active verdict is cached", ttl: time.Minute, raw: "live:alice", wantCalls: 1},
+		{name: "inactive verdict is not cached", ttl: time.Minute, raw: "rk_made_up", wantCalls: 3},
+		{name: "failed call is not cached", ttl: time.Minute, raw: "fail", wantCalls: 3, wantErr: true},
+		{name: "zero TTL disables the cache", ttl: 0, raw: "live:alice", wantCalls: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, auth := newTestClient(t, tt.ttl)
+			for i := 0; i < 3; i++ {
+				_, err := c.Introspect(context.Background(), tt.raw)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+				}
+			}
+			if got := auth.count(tt.raw); got != tt.wantCalls {
+				t.Errorf("calls to Auth = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClientExpiry(t *testing.T) {
+	c, auth := newTestClient(t, time.Minute)
+	introspectTimes(t, c, "live:alice", 1)
+
+	c.mu.Lock()
+	e := c.entries["live:alice"]
+	e.expires = time.Now().Add(-time.Second)
+	c.entries["live:alice"] = e
+	c.mu.Unlock()
+
+	introspectTimes(t, c, "live:alice", 1)
+	if got := auth.count("live:alice"); got != 2 {
+		t.Errorf("calls to Auth = %d, want 2", got)
+	}
+}
+
+func TestClientCap(t *testing.T) {
+	c, _ := newTestClient(t, time.Minute)
+	for i := 0; i < maxCacheEntries+10; i++ {
+		introspectTimes(t, c, "live:user"+strconv.Itoa(i), 1)
+	}
+	if n := len(c.entries); n > maxCacheEntries {
+		t.Errorf("cache holds %d entries, want at most %d", n, maxCacheEntries)
+	}
+	if _, ok := c.cached("live:user" + strconv.Itoa(maxCacheEntries+9)); !ok {
+		t.Error("latest verdict was not cached")
+	}
+}
+
+func TestClientEvict(t *testing.T) {
+	tests := []struct {
+		name    string
+		evict   string
+		wantBob int
+	}{
+		{name: "one user", evict: "alice", wantBob: 1},
+		{name: "everyone", evict: "", wantBob: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, auth := newTestClient(t, time.Minute)
+			introspectTimes(t, c, "live:alice", 1)
+			introspectTimes(t, c, "live:bob", 1)
+
+			c.Evict(tt.evict)
+			introspectTimes(t, c, "live:alice", 1)
+			introspectTimes(t, c, "live:bob", 1)
+
+			if got := auth.count("live:alice"); got != 2 {
+				t.Errorf("calls for alice = %d, want 2", got)
+			}
+			if got := auth.count("live:bob"); got != tt.wantBob {
+				t.Errorf("calls for bob = %d, want %d", got, tt.wantBob)
+			}
+		})
+	}
+}
+
+func TestClientStoreAfterEviction(t *testing.T) {
+	c, _ := newTestClient(t, time.Minute)
+	gen := c.generation()
+	c.Evict("alice")
+
+	resp := &Response{Active: true, Status: StatusActive, Claims: &token.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "alice"},
+	}}
+	c.store("live:alice", resp, gen)
+	if _, ok := c.cached("live:alice"); ok {
+		t.Error("verdict fetched before an eviction was cached")
+	}
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// HTTPMetrics holds the request counter and latency histogram of a service.
+type HTTPMetrics struct {
+	Requests *prometheus.CounterVec
+	Duration *prometheus.HistogramVec
+}
+
+// NewHTTPMetrics registers <prefix>http_requests_total and
+// <prefix>http_request_duration_seconds, both labeled by endpoint.
+func NewHTTPMetrics(prefix string) *HTTPMetrics {
+	return &HTTPMetrics{
+		Requests: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prefix + "http_requests_total",
+				Help: "Total number of HTTP requests processed, labeled by endpoint and status",
+			},
+			[]string{"endpoint", "status"},
+		),
+		Duration: promauto.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    prefix + "http_request_duration_seconds",
+				Help:    "Duration of HTTP requests in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"endpoint"},
+		),
+	}
+}
+
+// Middleware records every request by route and numeric status code.
+func (m *HTTPMetrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		endpoint := c.FullPath()
+		if endpoint == "" {
+			endpoint = "unknown"
+		}
+
+		status := strconv.Itoa(c.Writer.Status())
+		m.Requests.WithLabelValues(endpoint, status).Inc()
+		m.Duration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the Prometheus registry on a Gin route.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
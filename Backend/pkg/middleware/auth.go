@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	goredis "github.com/redis/go-redis/v9"
+
+	"rysto/pkg/apikey"
+	"rysto/pkg/token"
+	"rysto/pkg/userstatus"
+)
+
+var (
+	ErrTokenRevoked  = errors.New("token is no longer valid")
+	ErrTokenMismatch = errors.New("token does not match its session")
+)
+
+// RevocationCheck decides whether a token with a valid signature is still
+// active. It returns nil to let the request through.
+type RevocationCheck func(ctx context.Context, token string, claims *token.Claims) error
+
+// APIKeyResolver turns an API key into the claims it acts with. It returns
+// an error for unknown or revoked keys.
+type APIKeyResolver func(ctx context.Context, key string) (*token.Claims, error)
+
+// Auth validates the bearer token, runs the revocation check and stores
+// userId, handle, email, emailVerified, roles, token, sessionId and claims in
+// the Gin context. API keys are refused.
+func Auth(validator *token.Validator, check RevocationCheck) gin.HandlerFunc {
+	return AuthWithAPIKeys(validator, check, nil)
+}
+
+// AuthWithAPIKeys is Auth that also accepts API keys, sent either as
+// X-API-Key or as "Authorization: ApiKey {key}". Requests made with a key
+// carry its scopes in the claims and additionally set apiKeyId.
+func AuthWithAPIKeys(validator *token.Validator, check RevocationCheck, keys APIKeyResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, ok := extractAPIKey(c); ok {
+			if keys == nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API keys are not accepted here"})
+				return
+			}
+			claims, err := keys(c.Request.Context(), key)
+			if abortRestricted(c, err) {
+				return
+			}
+			if err != nil || claims.Subject == "" {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or revoked API key"})
+				return
+			}
+			setClaims(c, "", claims)
+			c.Next()
+			return
+		}
+
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			return
+		}
+
+		raw := token.ExtractBearer(authHeader)
+		if raw == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization format must be Bearer {token}"})
+			return
+		}
+
+		// Ownership everywhere is keyed by the subject, so a token without
+		// one must never reach a handler.
+		claims, err := validator.Validate(raw)
+		if err != nil || claims.Subject == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+
+		if check != nil {
+			err := check(c.Request.Context(), raw, claims)
+			if abortRestricted(c, err) {
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token is no longer valid"})
+				return
+			}
+		}
+
+		setClaims(c, raw, claims)
+		c.Next()
+	}
+}
+
+// abortRestricted rejects the request when err says the caller's account is
+// suspended or banned, telling them why and until when.
+func abortRestricted(c *gin.Context, err error) bool {
+	var restricted *userstatus.Error
+	if !errors.As(err, &restricted) {
+		return false
+	}
+	s := restricted.Status
+	body := gin.H{"error": "Account " + s.State, "status": s.State}
+	if s.Reason != "" {
+		body["reason"] = s.Reason
+	}
+	if !s.Until.IsZero() {
+		body["until"] = s.Until
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, body)
+	return true
+}
+
+func setClaims(c *gin.Context, raw string, claims *token.Claims) {
+	c.Set("userId", claims.Subject)
+	c.Set("handle", claims.Handle)
+	c.Set("email", claims.Email)
+	c.Set("emailVerified", claims.EmailVerified)
+	c.Set("roles", claims.Roles)
+	c.Set("token", raw)
+	c.Set("sessionId", claims.SessionID)
+	c.Set("apiKeyId", claims.KeyID)
+	c.Set("claims", claims)
+}
+
+// extractAPIKey returns the API key the request carries, if any.
+func extractAPIKey(c *gin.Context) (string, bool) {
+	if key := strings.TrimSpace(c.GetHeader("X-API-Key")); key != "" {
+		return key, true
+	}
+	scheme, key, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "apikey") {
+		return strings.TrimSpace(key), true
+	}
+	return "", false
+}
+
+// RedisAPIKeys resolves the API keys Auth publishes in Redis. Keys act for
+// their owner with the owner's verified status but no roles, so they can
+// never moderate or administer, and stop working while the owner is
+// suspended or banned.
+func RedisAPIKeys(client *goredis.Client) APIKeyResolver {
+	return func(ctx context.Context, key string) (*token.Claims, error) {
+		p, err := apikey.Resolve(ctx, client, key)
+		if err != nil {
+			return nil, err
+		}
+		if err := restricted(userstatus.Lookup(ctx, client, p.UserID)); err != nil {
+			return nil, err
+		}
+		return &token.Claims{
+			Handle: p.Handle,
+			// Auth only issues keys to verified accounts.
+			EmailVerified: true,
+			Scope:         strings.Join(p.Scopes, " "),
+			KeyID:         p.KeyID,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject: p.UserID,
+			},
+		}, nil
+	}
+}
+
+// RequireVerified rejects callers whose email address is not verified yet.
+// It must run after Auth.
+func RequireVerified() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("emailVerified") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole rejects callers whose token grants none of roles. It must run
+// after Auth.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.Get("claims")
+		if !ok || !claims.(*token.Claims).HasRole(roles...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope rejects callers whose credential is restricted to none of
+// scopes. Session tokens are unrestricted. It must run after Auth.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.Get("claims")
+		if !ok || !claims.(*token.Claims).HasScope(scopes...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient scope", "required": scopes})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+
+	"rysto/pkg/introspect"
+	"rysto/pkg/token"
+	"rysto/pkg/userstatus"
+)
+
+// IntrospectionCheck accepts a token only while Auth's /introspect reports it
+// active. It is the alternative to RedisTokenCheck for services that should
+// not know how Auth stores tokens; verdicts are cached by the client.
+func IntrospectionCheck(client *introspect.Client) RevocationCheck {
+	return func(ctx context.Context, raw string, claims *token.Claims) error {
+		resp, err := client.Introspect(ctx, raw)
+		if err != nil {
+			return err
+		}
+		if resp.Restriction != nil {
+			return &userstatus.Error{Status: *resp.Restriction}
+		}
+		if !resp.Active {
+			return ErrTokenRevoked
+		}
+		if resp.Claims.Subject != claims.Subject {
+			return ErrTokenMismatch
+		}
+		return nil
+	}
+}
+
+// IntrospectedAPIKeys resolves API keys through Auth's /introspect instead of
+// reading them from Redis.
+func IntrospectedAPIKeys(client *introspect.Client) APIKeyResolver {
+	return func(ctx context.Context, key string) (*token.Claims, error) {
+		resp, err := client.Introspect(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Restriction != nil {
+			return nil, &userstatus.Error{Status: *resp.Restriction}
+		}
+		if !resp.Active || resp.KeyID == "" {
+			return nil, ErrTokenRevoked
+		}
+		claims := *resp.Claims
+		claims.KeyID = resp.KeyID
+		return &claims, nil
+	}
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"rysto/pkg/token"
+	"rysto/pkg/userstatus"
+)
+
+// RedisTokenCheck accepts a token only while Auth keeps it in Redis and its
+// owner is not suspended or banned. Auth stores every live access token as a
+// key holding its owner's user ID and deletes it on logout or session
+// revocation.
+func RedisTokenCheck(client *goredis.Client) RevocationCheck {
+	return func(ctx context.Context, raw string, claims *token.Claims) error {
+		pipe := client.Pipeline()
+		get := pipe.Get(ctx, raw)
+		status := userstatus.LookupCmd(ctx, pipe, claims.Subject)
+		if _, err := pipe.Exec(ctx); err != nil && err != goredis.Nil {
+			return err
+		}
+
+		owner, err := get.Result()
+		if err == goredis.Nil {
+			return ErrTokenRevoked
+		}
+		if err != nil {
+			return err
+		}
+		if owner != claims.Subject {
+			return ErrTokenMismatch
+		}
+		return restricted(userstatus.Parse(status))
+	}
+}
+
+// restricted turns the outcome of a status lookup into the error that
+// rejects the credential, or nil when the account is in good standing.
+func restricted(s *userstatus.Status, err error) error {
+	if err != nil {
+		return err
+	}
+	if s != nil {
+		return &userstatus.Error{Status: *s}
+	}
+	return nil
+}
+
+// CachedCheck remembers tokens that passed check for ttl, so hot paths do not
+// cost a round trip per request. A revoked token keeps working for at most
+// ttl; failures are never cached. With client set, a user's tokens are
+// forgotten as soon as userstatus announces a change to their account, so
+// suspensions and bans apply at once.
+func CachedCheck(check RevocationCheck, ttl time.Duration, client *goredis.Client) RevocationCheck {
+	cache := &tokenCache{ttl: ttl, entries: make(map[string]cachedToken)}
+	if client != nil {
+		go userstatus.Watch(context.Background(), client, cache.evict)
+	}
+
+	return func(ctx context.Context, raw string, claims *token.Claims) error {
+		if cache.get(raw) {
+			return nil
+		}
+		gen := cache.generation()
+		if err := check(ctx, raw, claims); err != nil {
+			return err
+		}
+		cache.put(raw, claims.Subject, gen)
+		return nil
+	}
+}
+
+type tokenCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedToken
+	// gen counts evictions, so a check that raced one is not cached.
+	gen uint64
+}
+
+type cachedToken struct {
+	userID  string
+	expires time.Time
+}
+
+func (tc *tokenCache) get(raw string) bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	e, ok := tc.entries[raw]
+	if !ok {
+		return false
+	}
+	if time.Now().After(e.expires) {
+		delete(tc.entries, raw)
+		return false
+	}
+	return true
+}
+
+func (tc *tokenCache) generation() uint64 {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.gen
+}
+
+func (tc *tokenCache) put(raw, userID string, gen uint64) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if gen != tc.gen {
+		return
+	}
+	now := time.Now()
+	// Sweep expired entries once the map grows, so it cannot grow unbounded.
+	if len(tc.entries) >= 1024 {
+		for t, e := range tc.entries {
+			if now.After(e.expires) {
+				delete(tc.entries, t)
+			}
+		}
+	}
+	tc.entries[raw] = cachedToken{userID: userID, expires: now.Add(tc.ttl)}
+}
+
+// evict forgets the tokens of userID, or every token when it is empty.
+func (tc *tokenCache) evict(userID string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.gen++
+	for t, e := range tc.entries {
+		if userID == "" || e.userID == userID {
+			delete(tc.entries, t)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Package purge describes the internal call Auth makes to every service when
+// an account is deleted, asking it to anonymize or remove the user's content.
+package purge
+
+// Modes of a purge.
+const (
+	// ModeAnonymize keeps the content but reassigns it to the tombstone user.
+	ModeAnonymize = "anonymize"
+	// ModeDelete removes the content.
+	ModeDelete = "delete"
+)
+
+// Tombstone identity that anonymized content is reassigned to. The ID is not
+// a valid ObjectID, so no token subject can ever match it, and the brackets
+// keep the handle out of reach of anyone registering it.
+const (
+	DeletedUserID     = "deleted"
+	DeletedUserHandle = "[deleted]"
+)
+
+// Request is the body of POST /internal/users/:id/purge.
+type Request struct {
+	Mode string `json:"mode" binding:"required,oneof=anonymize delete"`
+
+	// RemovedContinuations are the IDs of the continuations Stories removed
+	// in this purge, whoever wrote them. Voting drops every vote on them.
+	RemovedContinuations []string `json:"removedContinuations,omitempty"`
+}
+
+// Report tells Auth what a service did, as counts per kind of content.
+type Report struct {
+	Service string           `json:"service"`
+	Mode    string           `json:"mode"`
+	Counts  map[string]int64 `json:"counts"`
+
+	// RemovedContinuations is set by Stories; Auth passes it on to Voting.
+	RemovedContinuations []string `json:"removedContinuations,omitempty"`
+}
+
+// ValidMode reports whether mode is ModeAnonymize or ModeDelete.
+func ValidMode(mode string) bool {
+	return mode == ModeAnonymize || mode == ModeDelete
+}
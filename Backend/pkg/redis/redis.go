@@ -13,6 +13,8 @@ var (
 	Client *redis.Client
 )
 
+// InitRedis connects to the Redis instance at REDIS_ADDR and exits the
+// process if it is unreachable.
 func InitRedis() {
 	addr := os.Getenv("REDIS_ADDR")
 	if addr == "" {
@@ -0,0 +1,38 @@
+// Package takeout defines what Stories and Voting return from their internal
+// export endpoints when Auth assembles a user's data export.
+package takeout
+
+import "time"
+
+type Story struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Continuation struct {
+	ID         string    `json:"id"`
+	StoryID    string    `json:"storyId"`
+	StoryTitle string    `json:"storyTitle,omitempty"`
+	Content    string    `json:"content"`
+	Accepted   bool      `json:"accepted"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type Vote struct {
+	ContinuationID string    `json:"continuationId"`
+	VotedAt        time.Time `json:"votedAt"`
+}
+
+// StoriesExport is the body of Stories' GET /internal/users/:id/export.
+type StoriesExport struct {
+	Stories       []Story        `json:"stories"`
+	Continuations []Continuation `json:"continuations"`
+}
+
+// VotesExport is the body of Voting's GET /internal/users/:id/export.
+type VotesExport struct {
+	Votes []Vote `json:"votes"`
+}
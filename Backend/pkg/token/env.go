@@ -0,0 +1,30 @@
+package token
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+// jwksRefresh is how long fetched signing keys are trusted before the JWKS
+// document is read again.
+const jwksRefresh = 10 * time.Minute
+
+// ValidatorFromEnv builds the validator a resource service should use. With
+// JWKS_URL set, tokens are verified against the Auth service's published
+// public keys; otherwise the shared JWT_SECRET is used.
+func ValidatorFromEnv() (*Validator, error) {
+	if url := os.Getenv("JWKS_URL"); url != "" {
+		keys := NewJWKS(url, jwksRefresh)
+		keys.Prefetch()
+		log.Printf("Verifying tokens with keys from %s", url)
+		return NewKeyValidator(keys), nil
+	}
+
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, errors.New("JWKS_URL or JWT_SECRET must be set")
+	}
+	return NewValidator([]byte(secret)), nil
+}
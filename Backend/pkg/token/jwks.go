@@ -0,0 +1,125 @@
+package token
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrUnknownKey = errors.New("no verification key for token kid")
+
+// KeySource resolves the public key that verifies a token with the given kid.
+type KeySource interface {
+	Key(kid string) (crypto.PublicKey, error)
+}
+
+// StaticKeys is a fixed set of public keys indexed by kid.
+type StaticKeys map[string]crypto.PublicKey
+
+func (s StaticKeys) Key(kid string) (crypto.PublicKey, error) {
+	if key, ok := s[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// minRefetchInterval stops a flood of tokens with bogus kids from turning
+// into a flood of requests to the JWKS endpoint.
+const minRefetchInterval = 10 * time.Second
+
+// JWKS is a KeySource backed by a remote JWKS document. Keys are cached for
+// the refresh interval and refetched early when an unknown kid shows up, so
+// a key that Auth starts publishing is picked up without a restart.
+type JWKS struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// NewJWKS returns a key source reading url and keeping keys for refresh.
+func NewJWKS(url string, refresh time.Duration) *JWKS {
+	return &JWKS{
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		keys:    make(map[string]crypto.PublicKey),
+	}
+}
+
+// Prefetch loads the key set once; failures are only logged because the Auth
+// service may still be starting.
+func (j *JWKS) Prefetch() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.fetchLocked(); err != nil {
+		log.Printf("JWKS: initial fetch from %s failed: %v", j.url, err)
+	}
+}
+
+func (j *JWKS) Key(kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	key, ok := j.keys[kid]
+	stale := time.Since(j.fetchedAt) > j.refresh
+	if ok && !stale {
+		return key, nil
+	}
+
+	if time.Since(j.lastAttempt) >= minRefetchInterval {
+		if err := j.fetchLocked(); err != nil {
+			log.Printf("JWKS: refresh from %s failed: %v", j.url, err)
+		}
+		key, ok = j.keys[kid]
+	}
+
+	// A stale key is still better than rejecting every request while the
+	// Auth service is briefly unreachable.
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (j *JWKS) fetchLocked() error {
+	j.lastAttempt = time.Now()
+
+	resp, err := j.client.Get(j.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		pub, err := jwk.PublicKey()
+		if err != nil {
+			log.Printf("JWKS: skipping key: %v", err)
+			continue
+		}
+		keys[jwk.Kid] = pub
+	}
+
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,34 @@
+package token
+
+// Roles carried in the "roles" claim. Every account has RoleUser; moderators
+// may remove content they did not write, admins may also manage roles.
+// RoleService is only ever held by tokens Auth mints for its own calls to
+// other services; it cannot be granted to an account.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+	RoleService   = "service"
+)
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// HasRole reports whether the claims grant any of roles. Admins implicitly
+// hold every account role, but not RoleService.
+func (c *Claims) HasRole(roles ...string) bool {
+	for _, have := range c.Roles {
+		for _, want := range roles {
+			if have == want || (have == RoleAdmin && want != RoleService) {
+				return true
+			}
+		}
+	}
+	return false
+}
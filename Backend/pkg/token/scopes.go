@@ -0,0 +1,46 @@
+package token
+
+import "strings"
+
+// Scopes limit what a credential may do, independently of the account's
+// roles. They are carried space-separated in the "scope" claim. Session
+// tokens carry no scope and are unrestricted; API keys always carry at least
+// one.
+const (
+	ScopeStoriesRead  = "stories:read"
+	ScopeStoriesWrite = "stories:write"
+	ScopeVotesRead    = "votes:read"
+	ScopeVotesWrite   = "votes:write"
+)
+
+// ValidScope reports whether scope is one of the known scopes.
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeStoriesRead, ScopeStoriesWrite, ScopeVotesRead, ScopeVotesWrite:
+		return true
+	}
+	return false
+}
+
+// Scopes returns the scopes the claims are restricted to, or nil when they
+// are unrestricted.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// HasScope reports whether the claims allow any of scopes. Unrestricted
+// claims allow everything.
+func (c *Claims) HasScope(scopes ...string) bool {
+	have := c.Scopes()
+	if len(have) == 0 {
+		return true
+	}
+	for _, h := range have {
+		for _, want := range scopes {
+			if h == want {
+				return true
+			}
+		}
+	}
+	return false
+}
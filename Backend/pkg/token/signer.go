@@ -0,0 +1,40 @@
+package token
+
+import (
+	"crypto"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Signer mints tokens on behalf of the Auth service.
+type Signer struct {
+	method jwt.SigningMethod
+	key    interface{}
+	kid    string
+}
+
+// NewSigner returns a signer producing HS256 tokens with secret.
+func NewSigner(secret []byte) *Signer {
+	return &Signer{method: jwt.SigningMethodHS256, key: secret}
+}
+
+// NewKeySigner returns a signer producing RS256 or EdDSA tokens, depending on
+// the key type, that carry kid in their header.
+func NewKeySigner(kid string, key crypto.Signer) (*Signer, error) {
+	method, err := signingMethod(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{method: method, key: key, kid: kid}, nil
+}
+
+// Sign creates a token for claims, filling in the issuer.
+func (s *Signer) Sign(claims *Claims) (string, error) {
+	claims.Issuer = Issuer
+
+	t := jwt.NewWithClaims(s.method, claims)
+	if s.kid != "" {
+		t.Header["kid"] = s.kid
+	}
+	return t.SignedString(s.key)
+}
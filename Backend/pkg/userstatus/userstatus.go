@@ -0,0 +1,133 @@
+// Package userstatus publishes which accounts are suspended or banned. Auth
+// owns the status; every service looks it up in Redis and rejects the
+// account's tokens and API keys while it is set. Every change is also
+// announced, so services can drop credentials they cached for the account.
+package userstatus
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// States of a restricted account.
+const (
+	Suspended = "suspended"
+	Banned    = "banned"
+)
+
+// Status is the restriction on an account. Until is zero for bans.
+type Status struct {
+	State  string    `json:"state"`
+	Reason string    `json:"reason,omitempty"`
+	Until  time.Time `json:"until,omitzero"`
+}
+
+// Error rejects a credential of a restricted account.
+type Error struct {
+	Status Status
+}
+
+func (e *Error) Error() string { return "account is " + e.Status.State }
+
+// Redis layout (written by Auth):
+//
+//	user_status:<userId> hash {state, reason, until (unix seconds)}
+//
+// The key of a suspension expires when the suspension ends; a ban's never
+// does. Publish and Clear announce the user ID on changesChannel.
+func key(userID string) string { return "user_status:" + userID }
+
+const changesChannel = "user_status_changes"
+
+// Publish records the restriction on an account.
+func Publish(ctx context.Context, client *goredis.Client, userID string, s Status) error {
+	until := ""
+	if !s.Until.IsZero() {
+		until = strconv.FormatInt(s.Until.Unix(), 10)
+	}
+
+	pipe := client.TxPipeline()
+	pipe.Del(ctx, key(userID))
+	pipe.HSet(ctx, key(userID), "state", s.State, "reason", s.Reason, "until", until)
+	if !s.Until.IsZero() {
+		pipe.ExpireAt(ctx, key(userID), s.Until)
+	}
+	pipe.Publish(ctx, changesChannel, userID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Clear lifts the restriction on an account.
+func Clear(ctx context.Context, client *goredis.Client, userID string) error {
+	pipe := client.TxPipeline()
+	pipe.Del(ctx, key(userID))
+	pipe.Publish(ctx, changesChannel, userID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Watch calls changed with the ID of every account whose restriction is
+// published or cleared, until ctx ends. Announcements made while the
+// subscription is down are lost, so changed is called with "" each time it
+// (re)starts, meaning any account may have changed.
+func Watch(ctx context.Context, client *goredis.Client, changed func(userID string)) {
+	sub := client.Subscribe(ctx, changesChannel)
+	defer sub.Close()
+
+	for {
+		msg, err := sub.Receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// The next Receive reconnects and subscribes again.
+			time.Sleep(time.Second)
+			continue
+		}
+		switch msg := msg.(type) {
+		case *goredis.Subscription:
+			changed("")
+		case *goredis.Message:
+			changed(msg.Payload)
+		}
+	}
+}
+
+// Lookup returns the restriction on an account, or nil when there is none.
+func Lookup(ctx context.Context, client *goredis.Client, userID string) (*Status, error) {
+	return Parse(client.HGetAll(ctx, key(userID)))
+}
+
+// LookupCmd queues the lookup of an account's restriction on pipe; pass the
+// result to Parse once the pipeline has run.
+func LookupCmd(ctx context.Context, pipe goredis.Pipeliner, userID string) *goredis.MapStringStringCmd {
+	return pipe.HGetAll(ctx, key(userID))
+}
+
+// Parse turns the result of LookupCmd into the restriction, or nil when
+// there is none.
+func Parse(cmd *goredis.MapStringStringCmd) (*Status, error) {
+	fields, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+	if fields["state"] == "" {
+		return nil, nil
+	}
+	s := &Status{State: fields["state"], Reason: fields["reason"]}
+	if fields["until"] != "" {
+		secs, err := strconv.ParseInt(fields["until"], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		s.Until = time.Unix(secs, 0).UTC()
+		// Redis expires the key at Until, but only to the second.
+		if !time.Now().Before(s.Until) {
+			return nil, nil
+		}
+	}
+	return s, nil
+}